@@ -0,0 +1,252 @@
+package ansi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Game text uses inline markup for color, which gets turned into ANSI escape codes
+// (or stripped out) by the connection, depending on what the client can handle.
+//
+//	{red} {green} ... {white}       normal foreground colors
+//	{RED} {GREEN} ... {WHITE}       bright foreground colors
+//	{208}                           one of the 256 xterm colors
+//	{#ff8800}                       24-bit color
+//	{bg:red} {bg:208} {bg:#ff8800}  the same, for the background
+//	{bold} {underline}              attributes
+//	{x} or {reset}                  back to normal
+//	{{                              a literal {
+//
+// Anything else in braces is left alone.
+
+type Mode int
+
+const (
+	None Mode = iota
+	ANSI16
+	ANSI256
+	TrueColor
+)
+
+var colorNames = map[string]int{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+}
+
+// xterm's default values for the 16 basic colors, used to find the nearest one
+// when a client can't show the color that was asked for
+var palette16 = [16][3]int{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+const resetCode = "\x1b[0m"
+
+// color is what a tag asks for: either an index into the 256-color palette (which
+// includes the basic 16), or an RGB value.
+type color struct {
+	index int
+	rgb   [3]int
+	isRGB bool
+}
+
+func Render(s string, mode Mode) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+	var b strings.Builder
+	colored := false
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '{' {
+			b.WriteByte('{')
+			i++
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+		code, ok := tagCode(s[i+1:i+end], mode)
+		if !ok {
+			b.WriteString(s[i : i+end+1])
+		} else if mode != None {
+			b.WriteString(code)
+			colored = code != resetCode
+		}
+		i += end
+	}
+	// don't let colors bleed into whatever gets sent next
+	if colored {
+		b.WriteString(resetCode)
+	}
+	return b.String()
+}
+
+// Strip removes all markup, leaving plain text.
+func Strip(s string) string {
+	return Render(s, None)
+}
+
+// Escape protects text typed by players, so they can't send color codes to other
+// players or break the markup around their text.
+func Escape(s string) string {
+	return strings.ReplaceAll(s, "{", "{{")
+}
+
+func tagCode(tag string, mode Mode) (string, bool) {
+	switch tag {
+	case "x", "reset":
+		return resetCode, true
+	case "bold":
+		return "\x1b[1m", true
+	case "underline":
+		return "\x1b[4m", true
+	}
+	bg := false
+	if after, ok := strings.CutPrefix(tag, "bg:"); ok {
+		bg = true
+		tag = after
+	}
+	c, ok := parseColor(tag)
+	if !ok {
+		return "", false
+	}
+	return sgr(c, bg, mode), true
+}
+
+func parseColor(tag string) (color, bool) {
+	if n, ok := colorNames[tag]; ok {
+		return color{index: n}, true
+	}
+	if n, ok := colorNames[strings.ToLower(tag)]; ok && tag == strings.ToUpper(tag) {
+		return color{index: n + 8}, true
+	}
+	if hex, ok := strings.CutPrefix(tag, "#"); ok && len(hex) == 6 {
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color{}, false
+		}
+		return color{rgb: [3]int{int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff)}, isRGB: true}, true
+	}
+	if n, err := strconv.Atoi(tag); err == nil && n >= 0 && n < 256 {
+		return color{index: n}, true
+	}
+	return color{}, false
+}
+
+func sgr(c color, bg bool, mode Mode) string {
+	switch mode {
+	case TrueColor:
+		if c.isRGB {
+			return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", extCode(bg), c.rgb[0], c.rgb[1], c.rgb[2])
+		}
+	case ANSI256:
+		if c.isRGB {
+			c = color{index: rgbTo256(c.rgb)}
+		}
+	default:
+		if c.isRGB {
+			c = color{index: nearest16(c.rgb)}
+		} else if c.index >= 16 {
+			c = color{index: nearest16(indexToRGB(c.index))}
+		}
+	}
+	if c.index < 16 {
+		// the basic 16 are sent as basic codes even when the client can do better,
+		// so they follow the player's own terminal color scheme
+		base := 30
+		if bg {
+			base = 40
+		}
+		if c.index >= 8 {
+			base += 60
+		}
+		return fmt.Sprintf("\x1b[%dm", base+c.index%8)
+	}
+	return fmt.Sprintf("\x1b[%d;5;%dm", extCode(bg), c.index)
+}
+
+func extCode(bg bool) int {
+	if bg {
+		return 48
+	}
+	return 38
+}
+
+func indexToRGB(n int) [3]int {
+	switch {
+	case n < 16:
+		return palette16[n]
+	case n < 232:
+		n -= 16
+		return [3]int{cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]}
+	default:
+		g := 8 + (n-232)*10
+		return [3]int{g, g, g}
+	}
+}
+
+func rgbTo256(rgb [3]int) int {
+	cube := 16
+	for i, mult := range []int{36, 6, 1} {
+		best := 0
+		for l := range cubeLevels {
+			if abs(cubeLevels[l]-rgb[i]) < abs(cubeLevels[best]-rgb[i]) {
+				best = l
+			}
+		}
+		cube += best * mult
+	}
+	avg := (rgb[0] + rgb[1] + rgb[2]) / 3
+	gray := 232 + (avg-8)/10
+	if gray < 232 {
+		gray = 232
+	} else if gray > 255 {
+		gray = 255
+	}
+	if distance(indexToRGB(gray), rgb) < distance(indexToRGB(cube), rgb) {
+		return gray
+	}
+	return cube
+}
+
+func nearest16(rgb [3]int) int {
+	best := 0
+	for i := range palette16 {
+		if distance(palette16[i], rgb) < distance(palette16[best], rgb) {
+			best = i
+		}
+	}
+	return best
+}
+
+func distance(a, b [3]int) int {
+	d := 0
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+package chara
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lpbeast/ecbmud/classes"
+)
+
+// MaxCharacters is how many characters one account can have.
+var MaxCharacters = 5
+
+// Account roles
+const (
+	ROLE_ADMIN = "admin"
+)
+
+// An Account is what a player logs in with. It owns any number of characters, up to
+// MaxCharacters, and holds anything that applies to the player rather than to one
+// of their characters.
+type Account struct {
+	Name       string   `json:"Name"`
+	PWHash     string   `json:"PWHash"`
+	Characters []string `json:"Characters"`
+	Banned     bool     `json:"Banned"`
+	BanReason  string   `json:"BanReason"`
+	Roles      []string `json:"Roles"`
+}
+
+// Login goroutines for different connections can all be creating accounts and
+// characters at once, so anything that checks and then changes accounts holds
+// this from the check to the save.
+var accountsMu sync.Mutex
+
+var errNameTaken = errors.New("name taken")
+
+func (a *Account) HasRole(role string) bool {
+	return slices.Contains(a.Roles, role)
+}
+
+// GetAccount looks up an account by name.
+func GetAccount(name string) (Account, error) {
+	return GlobalStore.LoadAccount(name)
+}
+
+// TakenNames returns every account and character name in use, in the form
+// checkValidName wants.
+func TakenNames() (map[string]string, error) {
+	names := map[string]string{}
+	accts, err := GlobalStore.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	chars, err := GlobalStore.ListCharacters()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range append(accts, chars...) {
+		names[v] = v
+	}
+	return names, nil
+}
+
+// takenCharNames is TakenNames for someone making a character on an account. A
+// character can have the same name as the account it belongs to, as long as there
+// isn't a character called that already.
+func takenCharNames(acctName string) (map[string]string, error) {
+	names, err := TakenNames()
+	if err != nil {
+		return nil, err
+	}
+	chars, err := GlobalStore.ListCharacters()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(chars, acctName) {
+		delete(names, acctName)
+	}
+	return names, nil
+}
+
+// CreateAccount adds a new account, failing if the name has been taken since the
+// player was asked for it.
+func CreateAccount(acct Account) error {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	names, err := TakenNames()
+	if err != nil {
+		return err
+	}
+	if names[acct.Name] != "" {
+		return errNameTaken
+	}
+	return GlobalStore.SaveAccount(acct)
+}
+
+// AddCharacter creates a new character of a race and class and records it as
+// belonging to an account.
+func AddCharacter(acctName string, charName string, raceID string, classID string) error {
+	race, ok := classes.GlobalRaceList[raceID]
+	if !ok {
+		return fmt.Errorf("no race %q", raceID)
+	}
+	class, ok := classes.GlobalClassList[classID]
+	if !ok {
+		return fmt.Errorf("no class %q", classID)
+	}
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	acct, err := GlobalStore.LoadAccount(acctName)
+	if err != nil {
+		return err
+	}
+	if len(acct.Characters) >= MaxCharacters {
+		return fmt.Errorf("account %q already has %d characters", acctName, len(acct.Characters))
+	}
+	names, err := takenCharNames(acctName)
+	if err != nil {
+		return err
+	}
+	if names[charName] != "" {
+		return errNameTaken
+	}
+	newCharSheet := NewCharSheet(charName, race, class)
+	if err := GlobalStore.SaveCharacter(&newCharSheet); err != nil {
+		return err
+	}
+	acct.Characters = append(acct.Characters, charName)
+	return GlobalStore.SaveAccount(acct)
+}
+
+func setPassword(acctName string, hash string) error {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	acct, err := GlobalStore.LoadAccount(acctName)
+	if err != nil {
+		return err
+	}
+	acct.PWHash = hash
+	return GlobalStore.SaveAccount(acct)
+}
+
+// MigrateCharList moves characters over from the list kept before accounts existed.
+// Each character becomes an account of its own, with the same name and password,
+// so nobody has to do anything differently to log in. The accounts go into s, which
+// needs to be where the old character files are, so the two end up together.
+func MigrateCharList(s Store, charListFile string) error {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	nameList, err := getNameList(charListFile)
+	if err != nil {
+		return err
+	}
+	for name, hash := range nameList {
+		acct := Account{
+			Name:       name,
+			PWHash:     hash,
+			Characters: []string{name},
+			Roles:      []string{},
+		}
+		if err := s.SaveAccount(acct); err != nil {
+			return err
+		}
+	}
+	return os.Rename(charListFile, charListFile+".migrated")
+}
+
+// matchCharacter finds which of an account's characters the player picked from the
+// menu, by number or by name.
+func matchCharacter(acct Account, choice string) (string, bool) {
+	for i, v := range acct.Characters {
+		if choice == fmt.Sprint(i+1) || strings.EqualFold(choice, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
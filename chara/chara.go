@@ -1,9 +1,9 @@
 package chara
 
 import (
-	"crypto/sha512"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -11,12 +11,17 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/lpbeast/ecbmud/ansi"
+	"github.com/lpbeast/ecbmud/classes"
 	"github.com/lpbeast/ecbmud/combat"
 	"github.com/lpbeast/ecbmud/items"
+	"github.com/lpbeast/ecbmud/telnet"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+// CharListFile is where characters and passwords were kept before accounts. It's
+// only read now to move old characters over to accounts.
 const CharListFile = "chara/charlist.csv"
 
 const (
@@ -34,9 +39,14 @@ var invalidNames = map[string]string{
 	"get":  "get",
 	"kill": "kill",
 	"cast": "cast",
+	// would clash with the accounts file on case-insensitive filesystems
+	"accounts": "accounts",
 }
 
 type CharSheet struct {
+	// SchemaVersion is the layout the character was saved with. See schema.go.
+	SchemaVersion int `json:"SchemaVersion"`
+
 	Name     string `json:"Name"`
 	Zone     string `json:"Zone"`
 	Location string `json:"Location"`
@@ -49,13 +59,36 @@ type CharSheet struct {
 	AtkRoll   int `json:"AtkRoll"`
 	DamRoll   int `json:"DamRoll"`
 
-	Inv []items.Item
+	// IDs of the character's race and class, see the classes package
+	Race  string     `json:"Race"`
+	Class string     `json:"Class"`
+	Level int        `json:"Level"`
+	XP    int        `json:"XP"`
+	Stats Attributes `json:"Stats"`
+	// proficiency in each skill the character has used, out of 100
+	Skills map[string]int `json:"Skills"`
+	// kept with the character so logging out doesn't get rid of poison
+	Affects combat.Affects `json:"Affects"`
+
+	Inv       []*items.Instance
+	Equipment items.Equipment `json:"Equipment"`
+
+	NoColor bool `json:"NoColor"`
 }
 
 type Transients struct {
 	Position  int
 	Targets   []combat.Combatant
 	AutoAtkCD int
+	// LinkDead is set when the player's connection drops without them quitting.
+	// LinkDeadTicks counts how long they've been gone.
+	LinkDead      bool
+	LinkDeadTicks int
+	// ticks since the character was last saved, for autosave
+	AutosaveTicks int
+	// the HP/MP last sent to the client over GMCP, so we only send Char.Vitals
+	// when something has actually changed
+	sentVitals [4]int
 }
 
 type ActiveCharacter struct {
@@ -113,39 +146,176 @@ func getNameList(fname string) (map[string]string, error) {
 	return nameList, nil
 }
 
+// DoLogin runs the login conversation for a new connection, sending prompts on ch
+// and reading replies from loginChan. If loginChan is closed because the player
+// disconnected, it gives up and returns without sending anything else. It also
+// returns without logging in if the account is banned, which hangs up on them.
 func DoLogin(ch chan string, loginChan chan string) {
-	name := ""
+	var acct Account
 	loggedIn := false
 	for !loggedIn {
-		ch <- "Enter a character name to log in, or 'new' to create a character.\nName: "
-		name = <-loginChan
+		ch <- "Enter your account name, or 'new' to create an account.\nAccount: "
+		name, ok := <-loginChan
+		if !ok {
+			return
+		}
 		if strings.ToLower(name) == "new" {
-			create(ch, loginChan)
+			acct, ok = createAccount(ch, loginChan)
+			if !ok {
+				return
+			}
 			loggedIn = true
 		} else {
 			name = cases.Title(language.English).String(name)
-			nameList, err := getNameList(CharListFile)
-			if err != nil {
-				log.Fatal(err)
+			// an unknown account gets asked for a password anyway, and has it
+			// checked against a hash as slow as a real one, so nobody can find out
+			// which accounts exist by trying names
+			var err error
+			acct, err = GetAccount(name)
+			known := err == nil
+			if !known {
+				acct = Account{PWHash: dummyHash}
 			}
-			storedHash := nameList[name]
 			ch <- "Password: "
-			sentPW := <-loginChan
-			hasher := sha512.New()
-			sentHash := fmt.Sprintf("%x", hasher.Sum([]byte(sentPW)))
-			if sentHash == storedHash {
+			ch <- telnet.EchoOff
+			sentPW, ok := <-loginChan
+			if !ok {
+				return
+			}
+			ch <- telnet.EchoOn
+			ok, needsUpgrade := CheckPassword(sentPW, acct.PWHash)
+			if ok && known {
 				loggedIn = true
+				if needsUpgrade {
+					if err := upgradePassword(acct.Name, sentPW); err != nil {
+						log.Printf("unable to upgrade password hash for %s: %s\n", acct.Name, err)
+					}
+				}
+			} else {
+				ch <- "Incorrect account name or password.\n"
 			}
 		}
 	}
+	if acct.Banned {
+		ch <- fmt.Sprintf("This account has been banned. %s\n", acct.BanReason)
+		return
+	}
+
+	name, ok := chooseCharacter(ch, loginChan, acct)
+	if !ok {
+		return
+	}
 	ch <- fmt.Sprintf("Success:%s", name)
 }
 
-func create(ch chan string, createChan chan string) {
+// chooseCharacter shows the account's characters and lets the player pick one or
+// make a new one.
+func chooseCharacter(ch chan string, loginChan chan string, acct Account) (string, bool) {
+	for {
+		menu := "\nYour characters:\n"
+		if len(acct.Characters) == 0 {
+			menu += "  (none yet)\n"
+		}
+		for i, v := range acct.Characters {
+			menu += fmt.Sprintf("  %d. %s\n", i+1, v)
+		}
+		if len(acct.Characters) < MaxCharacters {
+			menu += "Enter a number or name to play, or 'new' to create a character.\n> "
+		} else {
+			menu += "Enter a number or name to play.\n> "
+		}
+		ch <- menu
+		choice, ok := <-loginChan
+		if !ok {
+			return "", false
+		}
+		if strings.ToLower(choice) == "new" {
+			if len(acct.Characters) >= MaxCharacters {
+				ch <- fmt.Sprintf("You already have the most characters allowed, %d.\n", MaxCharacters)
+				continue
+			}
+			name, ok := create(ch, loginChan, acct.Name)
+			if !ok {
+				return "", false
+			}
+			if name == "" {
+				continue
+			}
+			return name, true
+		}
+		if name, ok := matchCharacter(acct, choice); ok {
+			return name, true
+		}
+		ch <- "You don't have a character by that name.\n"
+	}
+}
+
+// createAccount walks a player through making a new account, and returns it, or
+// false if the player disconnected partway through.
+func createAccount(ch chan string, createChan chan string) (Account, bool) {
 	var name, pw1, pw2 string
+	var ok bool
+	for {
+		nameList, err := TakenNames()
+		if err != nil {
+			log.Fatal(err)
+		}
+		ready := false
+		ch <- "Account names must be between 3 and 16 letters.\n"
+		for !ready {
+			ch <- "Enter a name for your account.\n"
+			if name, ok = <-createChan; !ok {
+				return Account{}, false
+			}
+			name = cases.Title(language.English).String(name)
+			ready = checkValidName(name, nameList, invalidNames)
+		}
+		pwready := false
+		ch <- telnet.EchoOff
+		for !pwready {
+			pw1ready := false
+			ch <- "Passwords must be between 8 and 64 characters long.\n"
+			for !pw1ready {
+				ch <- "Enter a password for your account.\n"
+				if pw1, ok = <-createChan; !ok {
+					return Account{}, false
+				}
+				pw1ready = checkValidPW(pw1)
+			}
+			ch <- "Confirm your password.\n"
+			if pw2, ok = <-createChan; !ok {
+				return Account{}, false
+			}
+			pwready = (pw1 == pw2)
+		}
+		ch <- telnet.EchoOn
+
+		pwHash, err := HashPassword(pw1)
+		if err != nil {
+			log.Fatal(err)
+		}
+		acct := Account{Name: name, PWHash: pwHash, Characters: []string{}, Roles: []string{}}
+		err = CreateAccount(acct)
+		if errors.Is(err, errNameTaken) {
+			// someone else got there between checking and saving
+			ch <- "That name was just taken, please choose another.\n"
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		return acct, true
+	}
+}
+
+// create walks a player through making a new character on their account, picking
+// its name, race and class, and returns its name, or false if the player
+// disconnected partway through. The name is empty if the character couldn't be
+// added to the account.
+func create(ch chan string, createChan chan string, acctName string) (string, bool) {
+	var name string
+	var ok bool
 	// get the list of existing names so we can check if a name is available
-	// nameList is a map from character name to hashed password
-	nameList, err := getNameList(CharListFile)
+	nameList, err := takenCharNames(acctName)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -154,76 +324,120 @@ func create(ch chan string, createChan chan string) {
 	ch <- "Do not use numbers, punctuation, spaces, MUD commands, or offensive words.\n"
 	for !ready {
 		ch <- "Enter a name for your character.\n"
-		name = <-createChan
+		if name, ok = <-createChan; !ok {
+			return "", false
+		}
 		name = cases.Title(language.English).String(name)
 		ready = checkValidName(name, nameList, invalidNames)
 	}
-	pwready := false
-	for !pwready {
-		pw1ready := false
-		ch <- "Passwords must be between 8 and 64 characters long.\n"
-		for !pw1ready {
-			ch <- "Enter a password for your character.\n"
-			pw1 = <-createChan
-			pw1ready = checkValidPW(pw1)
+
+	var race classes.Race
+	var class classes.Class
+	for {
+		race, ok = chooseFromMenu(ch, createChan, "Choose a race", classes.GlobalRaceList.Sorted(), func(r classes.Race) (string, string) {
+			return r.Name, fmt.Sprintf("%s (%s, %+d HP, %+d MP)", r.Desc, r.Stats, r.HP, r.MP)
+		})
+		if !ok {
+			return "", false
+		}
+		class, ok = chooseFromMenu(ch, createChan, "Choose a class", classes.GlobalClassList.Sorted(), func(c classes.Class) (string, string) {
+			return c.Name, fmt.Sprintf("%s (%s, %+d HP, %+d MP)", c.Desc, c.Stats, c.HP, c.MP)
+		})
+		if !ok {
+			return "", false
+		}
+		ch <- fmt.Sprintf("%s the %s %s. Is that right? (y/n)\n", name, race.Name, class.Name)
+		answer, ok := <-createChan
+		if !ok {
+			return "", false
+		}
+		if strings.HasPrefix(strings.ToLower(answer), "y") {
+			break
 		}
-		ch <- "Confirm your password.\n"
-		pw2 = <-createChan
-		pwready = (pw1 == pw2)
 	}
 
-	hasher := sha512.New()
-	pwHash := fmt.Sprintf("%x", hasher.Sum([]byte(pw1)))
-	newCharEntry := []string{name, pwHash}
-
-	listFile, err := os.OpenFile(CharListFile, os.O_APPEND|os.O_WRONLY, 0600)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer listFile.Close()
-	w := csv.NewWriter(listFile)
-	if err := w.Write(newCharEntry); err != nil {
-		log.Fatal(err)
+	if err := AddCharacter(acctName, name, race.ID, class.ID); err != nil {
+		if errors.Is(err, errNameTaken) {
+			ch <- "That name was just taken, please choose another.\n"
+		} else {
+			log.Printf("unable to add character %s to account %s: %s\n", name, acctName, err)
+			ch <- "Unable to create that character.\n"
+		}
+		return "", true
 	}
-	w.Flush()
-	charFileName := "chara" + string(os.PathSeparator) + name + ".json"
-	cf, err := os.OpenFile(charFileName, os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		log.Fatal(err)
+	return name, true
+}
+
+// chooseFromMenu shows a numbered list of choices and returns the one the player
+// picks, by number or by name. describe gives the name and description of each.
+func chooseFromMenu[T any](ch chan string, menuChan chan string, title string, list []T, describe func(T) (string, string)) (T, bool) {
+	var none T
+	for {
+		menu := "\n" + title + ":\n"
+		for i, v := range list {
+			name, desc := describe(v)
+			menu += fmt.Sprintf("  %d. %-12s %s\n", i+1, name, desc)
+		}
+		menu += "> "
+		ch <- menu
+		choice, ok := <-menuChan
+		if !ok {
+			return none, false
+		}
+		for i, v := range list {
+			name, _ := describe(v)
+			if choice == fmt.Sprint(i+1) || strings.EqualFold(choice, name) {
+				return v, true
+			}
+		}
+		ch <- "That isn't one of the choices.\n"
 	}
-	newCharSheet := CharSheet{name, "z1000", "r1000", "A formless being.\n", 100, 100, 100, 100, 0, 0, []items.Item{}}
-	jChar, err := json.MarshalIndent(newCharSheet, "", "\t")
-	if err != nil {
-		log.Fatal(err)
+}
+
+// NewCharSheet is the starting character sheet for a new character, with their
+// race and class mods applied.
+func NewCharSheet(name string, race classes.Race, class classes.Class) CharSheet {
+	hp := max(100+race.HP+class.HP, 1)
+	mp := max(100+race.MP+class.MP, 0)
+	return CharSheet{
+		SchemaVersion: CurrentSchemaVersion,
+		Name:          name,
+		Zone:          "z1000",
+		Location:      "r1000",
+		Desc:          "A formless being.\n",
+		HPCurrent:     hp,
+		HPMax:         hp,
+		MPCurrent:     mp,
+		MPMax:         mp,
+		AtkRoll:       0,
+		DamRoll:       0,
+		Race:          race.ID,
+		Class:         class.ID,
+		Level:         1,
+		Stats:         DefaultAttributes().addMods(race.Stats).addMods(class.Stats),
+		Skills:        map[string]int{},
+		Affects:       combat.Affects{},
+		Inv:           []*items.Instance{},
+		Equipment:     items.Equipment{},
 	}
-	cf.Write(jChar)
-	ch <- fmt.Sprintf("Success:%s", name)
 }
 
 func (c *CharSheet) ListContents() []string {
 	itemList := []string{}
 	for _, v := range c.Inv {
-		itemList = append(itemList, v.Name)
+		itemList = append(itemList, v.GetName())
 	}
 	return itemList
 }
 
-func (c *CharSheet) Insert(itm items.Item) {
+func (c *CharSheet) Insert(itm *items.Instance) {
 	c.Inv = append(c.Inv, itm)
 }
 
-func (c *CharSheet) Remove(itm string) error {
-	for k, v := range c.Inv {
-		if v.ID == itm {
-			if k == len(c.Inv)-1 {
-				c.Inv = c.Inv[:k]
-			} else {
-				c.Inv = append(c.Inv[:k], c.Inv[k+1:]...)
-			}
-			return nil
-		}
-	}
-	return fmt.Errorf("not found: %q", itm)
+func (c *CharSheet) Remove(itm *items.Instance) error {
+	var err error
+	c.Inv, err = items.RemoveInstance(c.Inv, itm)
+	return err
 }
 
 func AutoCompletePCs(stub string, chList []*ActiveCharacter) (*ActiveCharacter, error) {
@@ -235,11 +449,70 @@ func AutoCompletePCs(stub string, chList []*ActiveCharacter) (*ActiveCharacter,
 	return nil, fmt.Errorf("not found: %q", stub)
 }
 
+// Reconnect hands the character over to a new connection. The old connection's
+// channel is closed, which makes its handler hang up if it was still there.
+func (c *ActiveCharacter) Reconnect(ch chan string) {
+	if !c.TempInfo.LinkDead {
+		c.ResponseChannel <- "\nYou have logged in from somewhere else.\n"
+	}
+	close(c.ResponseChannel)
+	c.ResponseChannel = ch
+	c.TempInfo.LinkDead = false
+	c.TempInfo.LinkDeadTicks = 0
+	// the new client hasn't seen any vitals yet
+	c.TempInfo.sentVitals = [4]int{}
+}
+
+// SendColorPref tells the connection whether this player wants color.
+func (c *ActiveCharacter) SendColorPref() {
+	if c.CharData.NoColor {
+		c.ResponseChannel <- telnet.ColorOff
+	} else {
+		c.ResponseChannel <- telnet.ColorOn
+	}
+}
+
 func (c *ActiveCharacter) SendPrompt() {
 	p := fmt.Sprintf("\n%d/%d HP %d/%d MP >>", c.CharData.HPCurrent, c.CharData.HPMax, c.CharData.MPCurrent, c.CharData.MPMax)
 	c.ResponseChannel <- p
 }
 
+// SendGMCP sends out-of-band data to the player's client. Clients that didn't ask
+// for GMCP never see it.
+func (c *ActiveCharacter) SendGMCP(pkg string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("unable to marshal GMCP %s for %s: %s\n", pkg, c.GetName(), err)
+		return
+	}
+	c.ResponseChannel <- telnet.GMCPMessage(pkg, data)
+}
+
+// UpdateVitals sends Char.Vitals if HP or MP have changed since the last time it
+// was sent. It's called every tick rather than everywhere HP and MP get changed.
+func (c *ActiveCharacter) UpdateVitals() {
+	vitals := [4]int{c.CharData.HPCurrent, c.CharData.HPMax, c.CharData.MPCurrent, c.CharData.MPMax}
+	if vitals == c.TempInfo.sentVitals {
+		return
+	}
+	c.TempInfo.sentVitals = vitals
+	c.SendGMCP("Char.Vitals", map[string]int{
+		"hp":    vitals[0],
+		"maxhp": vitals[1],
+		"mp":    vitals[2],
+		"maxmp": vitals[3],
+	})
+}
+
+// SendComm sends Comm.Channel.Text so clients can split chat off into its own window.
+func (c *ActiveCharacter) SendComm(channel string, talker string, text string) {
+	c.SendGMCP("Comm.Channel.Text", map[string]string{
+		"channel": channel,
+		"talker":  talker,
+		"text":    ansi.Strip(text),
+	})
+}
+
 func (c *ActiveCharacter) EnterCombat(target combat.Combatant) {
 	c.TempInfo.AutoAtkCD = 0
 	c.TempInfo.Position = FIGHTING
@@ -254,10 +527,10 @@ func (c *ActiveCharacter) DoAutoAttack() (string, string) {
 	chAtkMsg := fmt.Sprintf("\nYou swing at %s.\n", c.TempInfo.Targets[0].GetName())
 	otherAtkMsg := fmt.Sprintf("\n%s swings at %s.\n", c.GetName(), c.TempInfo.Targets[0].GetName())
 	tn := 99 - c.TempInfo.Targets[0].GetDefense()
-	if rand.Intn(100)+c.CharData.AtkRoll <= tn {
-		dmg := rand.Intn(10) + 1 + c.CharData.DamRoll
+	if rand.Intn(100)-c.CharData.HitBonus() <= tn {
+		dmg := max(c.CharData.DamageDice().Roll()+c.CharData.DamBonus(), 1)
 		c.TempInfo.Targets[0].ReceiveDamage(dmg)
-		chAtkMsg += fmt.Sprintf("You hit %s for %d damage!\n", c.TempInfo.Targets[0].GetName(), dmg)
+		chAtkMsg += fmt.Sprintf("You hit %s for {RED}%d{x} damage!\n", c.TempInfo.Targets[0].GetName(), dmg)
 		otherAtkMsg += fmt.Sprintf("%s hits %s for %d damage.\n", c.GetName(), c.TempInfo.Targets[0].GetName(), dmg)
 	} else {
 		chAtkMsg += fmt.Sprintf("You miss %s.\n", c.TempInfo.Targets[0].GetName())
@@ -275,40 +548,24 @@ func (c *ActiveCharacter) GetName() string {
 }
 
 func (c *ActiveCharacter) GetDefense() int {
-	return 0
+	return c.CharData.Defense()
 }
 
 func (c *ActiveCharacter) GetHP() int {
 	return c.CharData.HPCurrent
 }
 
+// AddAffect puts an affect on the character, replacing any with the same name.
+func (c *ActiveCharacter) AddAffect(aff combat.Affect) {
+	c.CharData.Affects.Add(aff)
+}
+
 func (c *ActiveCharacter) ExitCombat() {
 	c.TempInfo.Position = STANDING
 	c.TempInfo.Targets = []combat.Combatant{}
 }
 
 func (c *ActiveCharacter) Save() error {
-	// this is not how it should be, BUT when i try to do it properly by saving a
-	// temp file and then renaming it over the original save, it claims that the
-	// file is in use by another process. But I can open it and just write over it
-	// with no problem?
-	// TODO: figure out what's going on with this and fix it, so that saves have
-	// less risk of getting corrupted.
-	// tempFileName := "chara" + string(os.PathSeparator) + c.GetName() + ".tmp"
-	charFileName := "chara" + string(os.PathSeparator) + c.GetName() + ".json"
-	cf, err := os.OpenFile(charFileName, os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
-	}
-	jChar, err := json.MarshalIndent(c.CharData, "", "\t")
-	if err != nil {
-		return err
-	}
-	_, err = cf.Write(jChar)
-	if err != nil {
-		return err
-	}
-	// err = os.Rename(tempFileName, charFileName)
-	// done now, so return err whether or not it's nil. ideally it should be nil.
-	return err
+	c.TempInfo.AutosaveTicks = 0
+	return GlobalStore.SaveCharacter(&c.CharData)
 }
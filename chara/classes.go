@@ -0,0 +1,46 @@
+package chara
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/lpbeast/ecbmud/classes"
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// RaceData is the definition of the character's race. If it's been taken out of
+// the game since, it's an empty one, which changes nothing.
+func (c *CharSheet) RaceData() classes.Race {
+	return classes.GlobalRaceList[c.Race]
+}
+
+// ClassData is the definition of the character's class, or an empty one.
+func (c *CharSheet) ClassData() classes.Class {
+	return classes.GlobalClassList[c.Class]
+}
+
+func (a Attributes) addMods(m classes.Mods) Attributes {
+	a.Str += m.Str
+	a.Dex += m.Dex
+	a.Vit += m.Vit
+	a.Int += m.Int
+	a.Wis += m.Wis
+	return a
+}
+
+// CanUse says why the character's race or class stops them using a piece of
+// equipment, or "" if it doesn't.
+func (c *CharSheet) CanUse(itm *items.Instance) string {
+	t := itm.Template()
+	race := c.RaceData()
+	class := c.ClassData()
+	switch {
+	case t.Weapon != nil && !class.CanWield(t.Weapon.DamType):
+		return fmt.Sprintf("A %s can't use %s weapons.", class.Name, t.Weapon.DamType)
+	case t.Armor != nil && !class.CanWear(t.Armor.AC):
+		return fmt.Sprintf("The %s is too heavy for a %s.", itm.GetName(), class.Name)
+	case t.Armor != nil && slices.Contains(race.NoSlots, t.Armor.Slot):
+		return fmt.Sprintf("Nothing fits on a %s's %s.", race.Name, t.Armor.Slot)
+	}
+	return ""
+}
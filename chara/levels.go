@@ -0,0 +1,60 @@
+package chara
+
+import (
+	"fmt"
+	"time"
+)
+
+// levelXP is the total experience needed to reach each level. levelXP[0] is level 1.
+var levelXP = []int{0, 100, 250, 500, 850, 1300, 1900, 2650, 3600, 4800, 6300, 8100, 10200, 12700, 15600, 19000, 23000, 27500, 32600, 38400}
+
+// MaxLevel is as high as characters can go.
+var MaxLevel = len(levelXP)
+
+// XPForLevel is the total experience needed to reach a level.
+func XPForLevel(level int) int {
+	return levelXP[min(max(level, 1), MaxLevel)-1]
+}
+
+// GainXP gives a character experience and levels them up as far as it takes them.
+// It tells the player, and returns how many levels they gained so the caller can
+// let the room know.
+func (c *ActiveCharacter) GainXP(xp int) int {
+	if xp <= 0 {
+		return 0
+	}
+	c.CharData.XP += xp
+	c.ResponseChannel <- fmt.Sprintf("You gain {YELLOW}%d{x} experience.\n", xp)
+	gained := 0
+	for c.CharData.Level < MaxLevel && c.CharData.XP >= XPForLevel(c.CharData.Level+1) {
+		c.levelUp()
+		gained++
+	}
+	return gained
+}
+
+// levelUp raises a character one level. HP and MP go up by however much their class
+// gets, and a bit more for those with good vitality and wisdom, and every fifth
+// level all their attributes go up.
+func (c *ActiveCharacter) levelUp() {
+	cs := &c.CharData
+	cs.Level++
+	class := cs.ClassData()
+	hp := max(class.HPPerLevel+statMod(cs.Stats.Vit), 1)
+	mp := max(class.MPPerLevel+statMod(cs.Stats.Wis), 1)
+	cs.HPMax += hp
+	cs.MPMax += mp
+	cs.HPCurrent += hp
+	cs.MPCurrent += mp
+	msg := fmt.Sprintf("\n{GREEN}You have reached level %d!{x} You gain %d HP and %d MP.\n", cs.Level, hp, mp)
+	if cs.Level%5 == 0 {
+		cs.Stats.Str++
+		cs.Stats.Dex++
+		cs.Stats.Vit++
+		cs.Stats.Int++
+		cs.Stats.Wis++
+		msg += "All of your attributes increase by 1.\n"
+	}
+	c.ResponseChannel <- msg
+	fmt.Printf("LOG %v %q reached level %d.\n", time.Now(), cs.Name, cs.Level)
+}
@@ -0,0 +1,53 @@
+package chara
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt stores its cost in the hash itself, so this can be raised later and
+// older hashes will be upgraded as players log in.
+const bcryptCost = 12
+
+// dummyHash is checked against when someone tries to log in to an account that
+// doesn't exist, so it takes as long as a real account would. It has to be kept at
+// bcryptCost.
+const dummyHash = "$2a$12$SzellncpnXDhnBmpU6n/vuUUlgwwDHiqYMGQWARExMGUkhYQMahj6"
+
+func HashPassword(pw string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether pw matches the stored hash, and if so, whether the
+// stored hash is out of date and should be replaced with a new one.
+func CheckPassword(pw string, stored string) (bool, bool) {
+	if !strings.HasPrefix(stored, "$2") {
+		// Hashes from before bcrypt were this, which isn't even a SHA-512 of the
+		// password: Sum appends the digest of nothing to the password bytes.
+		hasher := sha512.New()
+		legacy := fmt.Sprintf("%x", hasher.Sum([]byte(pw)))
+		ok := subtle.ConstantTimeCompare([]byte(legacy), []byte(stored)) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(pw)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost < bcryptCost
+}
+
+func upgradePassword(acctName string, pw string) error {
+	hash, err := HashPassword(pw)
+	if err != nil {
+		return err
+	}
+	return setPassword(acctName, hash)
+}
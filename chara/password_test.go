@@ -0,0 +1,19 @@
+package chara
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// an unknown account is only as slow to log in to as a real one while the dummy hash
+// costs the same as new ones
+func TestDummyHashCost(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != bcryptCost {
+		t.Errorf("dummyHash has cost %d, want bcryptCost %d", cost, bcryptCost)
+	}
+}
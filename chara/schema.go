@@ -0,0 +1,153 @@
+package chara
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lpbeast/ecbmud/classes"
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// CurrentSchemaVersion is the layout of CharSheet this server saves. Whenever a
+// change to CharSheet means older saves need fixing up to load properly, bump it
+// and add a migration from the old version to characterMigrations.
+const CurrentSchemaVersion = 8
+
+// A migration upgrades a saved character from one schema version to the next. It
+// works on the raw JSON rather than a CharSheet, so it can still see fields that
+// have since been renamed or removed.
+type migration func(cs map[string]any) error
+
+// characterMigrations holds the migration from each version to the one after it.
+var characterMigrations = map[int]migration{
+	0: migrateV0,
+	1: migrateV1,
+	2: migrateV2,
+	3: migrateV3,
+	4: migrateV4,
+	5: migrateV5,
+	6: migrateV6,
+	7: migrateV7,
+}
+
+// Version 0 is everything saved before there was a schema version.
+func migrateV0(cs map[string]any) error {
+	// an inventory saved as null would come back nil, which is fine until
+	// something tries to list it
+	if cs["Inv"] == nil {
+		cs["Inv"] = []any{}
+	}
+	// a character with nowhere to stand can't be logged in, so put them at the start
+	if cs["Zone"] == nil || cs["Zone"] == "" || cs["Location"] == nil || cs["Location"] == "" {
+		cs["Zone"] = "z1000"
+		cs["Location"] = "r1000"
+	}
+	return nil
+}
+
+// Version 1 kept whole copies of item templates in the inventory. Version 2 keeps
+// item instances, so each old item becomes a new instance of its template.
+func migrateV1(cs map[string]any) error {
+	oldInv, ok := cs["Inv"].([]any)
+	if !ok {
+		return fmt.Errorf("inventory is %T, not a list", cs["Inv"])
+	}
+	newInv := []any{}
+	for _, v := range oldInv {
+		oldItem, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("inventory item is %T, not an object", v)
+		}
+		id, _ := oldItem["ID"].(string)
+		itm, err := items.NewInstance(id)
+		if err != nil {
+			// the template has been taken out of the game since, so the item goes too
+			fmt.Printf("LOG %v Dropping item %q from %v's inventory: %s\n", time.Now(), id, cs["Name"], err)
+			continue
+		}
+		newInv = append(newInv, itm)
+	}
+	cs["Inv"] = newInv
+	return nil
+}
+
+// Version 3 added equipment, which nobody has any of yet.
+func migrateV2(cs map[string]any) error {
+	cs["Equipment"] = map[string]any{}
+	return nil
+}
+
+// Version 4 added attributes, and everyone who was around before gets average ones.
+func migrateV3(cs map[string]any) error {
+	cs["Stats"] = DefaultAttributes()
+	return nil
+}
+
+// Version 5 added levels and experience, and everyone starts from the beginning.
+func migrateV4(cs map[string]any) error {
+	cs["Level"] = 1
+	cs["XP"] = 0
+	return nil
+}
+
+// Version 6 added races and classes. Everyone from before is a human warrior, but
+// they keep the stats they had rather than getting the mods for them.
+func migrateV5(cs map[string]any) error {
+	cs["Race"] = classes.DefaultRace
+	cs["Class"] = classes.DefaultClass
+	return nil
+}
+
+// Version 7 added skill proficiency, and nobody had used any skills yet.
+func migrateV6(cs map[string]any) error {
+	cs["Skills"] = map[string]any{}
+	return nil
+}
+
+// Version 8 saves affects, and there weren't any before.
+func migrateV7(cs map[string]any) error {
+	cs["Affects"] = []any{}
+	return nil
+}
+
+// DecodeCharacter loads a saved character, bringing it up to date first if it was
+// saved with an older schema.
+func DecodeCharacter(data []byte) (CharSheet, error) {
+	cs := CharSheet{}
+	raw := map[string]any{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return cs, err
+	}
+	version := 0
+	if v, ok := raw["SchemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if version > CurrentSchemaVersion {
+		return cs, fmt.Errorf("character saved with schema version %d, but this server only knows up to %d", version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		err := json.Unmarshal(data, &cs)
+		return cs, err
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		m, ok := characterMigrations[v]
+		if !ok {
+			return cs, fmt.Errorf("no migration from character schema version %d", v)
+		}
+		if err := m(raw); err != nil {
+			return cs, fmt.Errorf("migrating character from schema version %d: %w", v, err)
+		}
+		raw["SchemaVersion"] = v + 1
+	}
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return cs, err
+	}
+	if err := json.Unmarshal(migrated, &cs); err != nil {
+		return cs, err
+	}
+	fmt.Printf("LOG %v Upgraded character %q from schema version %d to %d.\n", time.Now(), cs.Name, version, CurrentSchemaVersion)
+	return cs, nil
+}
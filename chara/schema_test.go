@@ -0,0 +1,135 @@
+package chara
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lpbeast/ecbmud/classes"
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// the fixtures in testdata are saves from each schema version, and the v1 one has an
+// old inventory that needs these templates to turn into instances
+func TestMain(m *testing.M) {
+	items.GlobalItemList = items.ItemList{
+		"i0001": {ID: "i0001", Name: "cold blue chain", Type: items.TYPE_ARMOR, Armor: &items.ArmorData{AC: 1, Slot: "neck"}},
+		"i0004": {ID: "i0004", Name: "egg", Type: items.TYPE_FOOD, Food: &items.FoodData{Nutrition: 5}},
+	}
+	os.Exit(m.Run())
+}
+
+func loadFixture(t *testing.T, version int) CharSheet {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("v%d.json", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := DecodeCharacter(data)
+	if err != nil {
+		t.Fatalf("decoding v%d: %s", version, err)
+	}
+	return cs
+}
+
+func TestDecodeEveryVersion(t *testing.T) {
+	statted := Attributes{Str: 14, Dex: 12, Vit: 10, Int: 9, Wis: 8}
+	for v := 0; v < CurrentSchemaVersion; v++ {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			cs := loadFixture(t, v)
+			if cs.SchemaVersion != CurrentSchemaVersion {
+				t.Errorf("SchemaVersion is %d, want %d", cs.SchemaVersion, CurrentSchemaVersion)
+			}
+			if cs.Inv == nil {
+				t.Error("Inv is nil")
+			}
+
+			// Equipment came in with version 3
+			if cs.Equipment == nil {
+				t.Error("Equipment is nil")
+			}
+			if v >= 3 && cs.Equipment["neck"] == nil {
+				t.Error("lost the equipment it was saved with")
+			}
+
+			// Stats with version 4
+			wantStats := DefaultAttributes()
+			if v >= 4 {
+				wantStats = statted
+			}
+			if cs.Stats != wantStats {
+				t.Errorf("Stats are %+v, want %+v", cs.Stats, wantStats)
+			}
+
+			// Level and XP with version 5
+			wantLevel, wantXP := 1, 0
+			if v >= 5 {
+				wantLevel, wantXP = 3, 310
+			}
+			if cs.Level != wantLevel || cs.XP != wantXP {
+				t.Errorf("level %d with %d XP, want level %d with %d XP", cs.Level, cs.XP, wantLevel, wantXP)
+			}
+
+			// Race and Class with version 6
+			wantRace, wantClass := classes.DefaultRace, classes.DefaultClass
+			if v >= 6 {
+				wantRace, wantClass = "elf", "mage"
+			}
+			if cs.Race != wantRace || cs.Class != wantClass {
+				t.Errorf("a %s %s, want a %s %s", cs.Race, cs.Class, wantRace, wantClass)
+			}
+
+			// Skills with version 7
+			if cs.Skills == nil {
+				t.Error("Skills is nil")
+			}
+			wantSkills := 0
+			if v >= 7 {
+				wantSkills = 1
+				if cs.Skills["magic missile"] != 40 {
+					t.Errorf("magic missile proficiency is %d, want 40", cs.Skills["magic missile"])
+				}
+			}
+			if len(cs.Skills) != wantSkills {
+				t.Errorf("has %d skills, want %d", len(cs.Skills), wantSkills)
+			}
+
+			// Affects with version 8
+			if cs.Affects == nil || len(cs.Affects) != 0 {
+				t.Errorf("Affects are %v, want an empty list", cs.Affects)
+			}
+		})
+	}
+}
+
+func TestMigrateV0(t *testing.T) {
+	cs := loadFixture(t, 0)
+	if cs.Zone != "z1000" || cs.Location != "r1000" {
+		t.Errorf("in %s/%s, want z1000/r1000", cs.Zone, cs.Location)
+	}
+	if len(cs.Inv) != 0 {
+		t.Errorf("has %d items, want none", len(cs.Inv))
+	}
+	if cs.HPCurrent != 90 {
+		t.Errorf("HPCurrent is %d, want 90", cs.HPCurrent)
+	}
+}
+
+func TestMigrateV1(t *testing.T) {
+	cs := loadFixture(t, 1)
+	// the egg becomes an instance, and the item with no template is dropped
+	if len(cs.Inv) != 1 {
+		t.Fatalf("has %d items, want 1", len(cs.Inv))
+	}
+	if cs.Inv[0].TemplateID != "i0004" || cs.Inv[0].UUID == "" {
+		t.Errorf("item is %+v, want a new instance of i0004", cs.Inv[0])
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	data := []byte(fmt.Sprintf(`{"SchemaVersion": %d, "Name": "Future"}`, CurrentSchemaVersion+1))
+	if _, err := DecodeCharacter(data); err == nil {
+		t.Error("loaded a character from a newer schema without an error")
+	}
+}
@@ -0,0 +1,66 @@
+package chara
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/lpbeast/ecbmud/skills"
+)
+
+// AvailableSkills lists the skills the character's race and class have given them
+// by their level.
+func (c *CharSheet) AvailableSkills() []string {
+	skills := []string{}
+	for _, list := range []map[string]int{c.RaceData().Skills, c.ClassData().Skills} {
+		for k, lvl := range list {
+			if lvl <= c.Level && !slices.Contains(skills, k) {
+				skills = append(skills, k)
+			}
+		}
+	}
+	sort.Strings(skills)
+	return skills
+}
+
+// StartingProficiency is how good characters are at a skill before they've used it.
+const StartingProficiency = 25
+
+// Proficiency is the character's chance out of 100 of a skill working, or 0 if
+// they don't have it.
+func (c *CharSheet) Proficiency(name string) int {
+	if !slices.Contains(c.AvailableSkills(), name) {
+		return 0
+	}
+	if p, ok := c.Skills[name]; ok {
+		return p
+	}
+	return StartingProficiency
+}
+
+// Practice is called whenever a character uses a skill, and sometimes makes them
+// better at it. The better they already are, the less likely that is. It returns
+// whether they improved.
+func (c *CharSheet) Practice(name string) bool {
+	p := c.Proficiency(name)
+	if p == 0 || p >= 100 || rand.Intn(200) >= 100-p {
+		return false
+	}
+	if c.Skills == nil {
+		c.Skills = map[string]int{}
+	}
+	c.Skills[name] = p + 1
+	return true
+}
+
+// SkillBonus is added to what a skill rolls. Skills are as good as the character's
+// strength, damaging spells their intelligence, and healing spells their wisdom.
+func (c *CharSheet) SkillBonus(s *skills.Skill) int {
+	switch {
+	case !s.Spell:
+		return c.DamBonus()
+	case s.Effect == skills.EFFECT_HEAL:
+		return statMod(c.Stats.Wis)
+	}
+	return statMod(c.Stats.Int)
+}
@@ -0,0 +1,106 @@
+package chara
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// Attributes are a character's primary stats. 10 is average, and everything else
+// about how good they are at things is worked out from these, their gear, and
+// AtkRoll/DamRoll for anything that doesn't fit anywhere else.
+type Attributes struct {
+	Str int `json:"Str"`
+	Dex int `json:"Dex"`
+	Vit int `json:"Vit"`
+	Int int `json:"Int"`
+	Wis int `json:"Wis"`
+}
+
+func DefaultAttributes() Attributes {
+	return Attributes{Str: 10, Dex: 10, Vit: 10, Int: 10, Wis: 10}
+}
+
+// statMod is the bonus (or penalty) an attribute gives: +1 for every 2 points over 10.
+func statMod(score int) int {
+	d := score - 10
+	if d < 0 {
+		// round down, not towards zero, so a 9 is a penalty
+		return (d - 1) / 2
+	}
+	return d / 2
+}
+
+// HitBonus is added to attack rolls.
+func (c *CharSheet) HitBonus() int {
+	return c.AtkRoll + statMod(c.Stats.Dex) + c.Affects.HitMod()
+}
+
+// DamBonus is added to damage.
+func (c *CharSheet) DamBonus() int {
+	return c.DamRoll + statMod(c.Stats.Str) + c.Affects.DamMod()
+}
+
+// Defense is taken off attackers' chance to hit.
+func (c *CharSheet) Defense() int {
+	return c.Equipment.AC() + statMod(c.Stats.Dex) + c.Affects.DefMod()
+}
+
+// DamageDice is what the character rolls for damage before DamBonus.
+func (c *CharSheet) DamageDice() items.Dice {
+	if w := c.Equipment.Weapon(); w != nil {
+		return w.Dice
+	}
+	// bare hands
+	return items.Dice{Num: 1, Sides: 10}
+}
+
+// HPRegen is how much HP comes back each heal tick.
+func (c *CharSheet) HPRegen() int {
+	return max(5+statMod(c.Stats.Vit), 1)
+}
+
+// MPRegen is how much MP comes back each heal tick.
+func (c *CharSheet) MPRegen() int {
+	return max(5+statMod(c.Stats.Wis), 1)
+}
+
+// ScoreSheet is the SCORE screen.
+func (c *CharSheet) ScoreSheet() string {
+	s := fmt.Sprintf("{CYAN}%s{x}, level %d %s %s\n", c.Name, c.Level, c.RaceData().Name, c.ClassData().Name)
+	if c.Level < MaxLevel {
+		s += fmt.Sprintf("Experience: %d (%d more to level %d)\n", c.XP, XPForLevel(c.Level+1)-c.XP, c.Level+1)
+	} else {
+		s += fmt.Sprintf("Experience: %d\n", c.XP)
+	}
+	s += fmt.Sprintf("HP: %d/%d   MP: %d/%d\n", c.HPCurrent, c.HPMax, c.MPCurrent, c.MPMax)
+	s += fmt.Sprintf("Regen: %d HP, %d MP\n\n", c.HPRegen(), c.MPRegen())
+	stat := func(name string, score int) string {
+		return fmt.Sprintf("  %-12s %3d (%+d)\n", name, score, statMod(score))
+	}
+	s += stat("Strength", c.Stats.Str)
+	s += stat("Dexterity", c.Stats.Dex)
+	s += stat("Vitality", c.Stats.Vit)
+	s += stat("Intelligence", c.Stats.Int)
+	s += stat("Wisdom", c.Stats.Wis)
+	s += "\n"
+	s += fmt.Sprintf("To hit: %+d   Damage: %s%+d\n", c.HitBonus(), c.DamageDice(), c.DamBonus())
+	s += fmt.Sprintf("Armor: %d   Defense: %d\n", c.Equipment.AC(), c.Defense())
+	if skills := c.AvailableSkills(); len(skills) > 0 {
+		list := []string{}
+		for _, v := range skills {
+			list = append(list, fmt.Sprintf("%s %d%%", v, c.Proficiency(v)))
+		}
+		s += fmt.Sprintf("Skills: %s\n", strings.Join(list, ", "))
+	}
+	if len(c.Affects) > 0 {
+		list := []string{}
+		for _, v := range c.Affects {
+			// ticks are a tenth of a second
+			list = append(list, fmt.Sprintf("%s (%ds)", v.Desc, (v.Duration+9)/10))
+		}
+		s += fmt.Sprintf("You are: %s\n", strings.Join(list, ", "))
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package chara
+
+import (
+	"errors"
+)
+
+// ErrNotFound is returned by a Store when asked for a character or account it
+// doesn't have.
+var ErrNotFound = errors.New("not found")
+
+// Store is where characters and accounts are kept between sessions. The
+// implementations are in the store package, which has to import this one for the
+// types, so the interface lives here.
+type Store interface {
+	LoadCharacter(name string) (CharSheet, error)
+	SaveCharacter(cs *CharSheet) error
+	ListCharacters() ([]string, error)
+	DeleteCharacter(name string) error
+
+	LoadAccount(name string) (Account, error)
+	SaveAccount(acct Account) error
+	ListAccounts() ([]string, error)
+
+	Close() error
+}
+
+// Just like with items and zones, it's easier to have one global store than to pass
+// it down through the login code and every command that saves.
+var GlobalStore Store
@@ -0,0 +1,204 @@
+package classes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/lpbeast/ecbmud/items"
+	"github.com/lpbeast/ecbmud/skills"
+)
+
+// The race and class anyone from before there were races and classes gets, and
+// what the admin character made at setup gets
+const (
+	DefaultRace  = "human"
+	DefaultClass = "warrior"
+)
+
+// Mods are added to a character's attributes. They're kept separate from the
+// character's own attributes so this package doesn't need to know about characters.
+type Mods struct {
+	Str int `json:"Str"`
+	Dex int `json:"Dex"`
+	Vit int `json:"Vit"`
+	Int int `json:"Int"`
+	Wis int `json:"Wis"`
+}
+
+type Race struct {
+	ID    string `json:"ID"`
+	Name  string `json:"Name"`
+	Desc  string `json:"Desc"`
+	Stats Mods   `json:"Stats"`
+	// added to starting HP and MP
+	HP int `json:"HP"`
+	MP int `json:"MP"`
+	// wear slots the race can't use, because of horns or claws or whatever
+	NoSlots []string `json:"NoSlots"`
+	// skills the race gets, and the level they get them at
+	Skills map[string]int `json:"Skills"`
+}
+
+type Class struct {
+	ID    string `json:"ID"`
+	Name  string `json:"Name"`
+	Desc  string `json:"Desc"`
+	Stats Mods   `json:"Stats"`
+	// added to starting HP and MP
+	HP int `json:"HP"`
+	MP int `json:"MP"`
+	// HP and MP gained every level, before attribute bonuses
+	HPPerLevel int `json:"HPPerLevel"`
+	MPPerLevel int `json:"MPPerLevel"`
+	// damage types of the weapons the class can wield, or empty for any weapon
+	Weapons []string `json:"Weapons"`
+	// the heaviest armor, by AC, the class can wear, or 0 for any armor
+	MaxArmorAC int `json:"MaxArmorAC"`
+	// skills the class gets, and the level they get them at
+	Skills map[string]int `json:"Skills"`
+}
+
+type RaceList map[string]Race
+type ClassList map[string]Class
+
+var GlobalRaceList RaceList
+var GlobalClassList ClassList
+
+// LoadClasses loads the races and classes players can choose from.
+func LoadClasses() error {
+	GlobalRaceList = RaceList{}
+	GlobalClassList = ClassList{}
+	if err := loadJSON("classes/races.json", &GlobalRaceList); err != nil {
+		return err
+	}
+	if err := loadJSON("classes/classes.json", &GlobalClassList); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for k, v := range GlobalRaceList {
+		if err := v.validate(k); err != nil {
+			errs = append(errs, fmt.Errorf("race %s: %w", k, err))
+		}
+	}
+	for k, v := range GlobalClassList {
+		if err := v.validate(k); err != nil {
+			errs = append(errs, fmt.Errorf("class %s: %w", k, err))
+		}
+	}
+	if _, ok := GlobalRaceList[DefaultRace]; !ok {
+		errs = append(errs, fmt.Errorf("no default race %q", DefaultRace))
+	}
+	if _, ok := GlobalClassList[DefaultClass]; !ok {
+		errs = append(errs, fmt.Errorf("no default class %q", DefaultClass))
+	}
+	return errors.Join(errs...)
+}
+
+func loadJSON(fname string, v any) error {
+	f, err := os.ReadFile(fname)
+	if err != nil {
+		fmt.Printf("unable to open %s: %s", fname, err)
+		return err
+	}
+	err = json.Unmarshal(f, v)
+	if err != nil {
+		fmt.Printf("error unmarshaling JSON in %s: %s", fname, err)
+		return err
+	}
+	return nil
+}
+
+func (r Race) validate(key string) error {
+	if r.ID != key {
+		return fmt.Errorf("listed as %q but has ID %q", key, r.ID)
+	}
+	for _, v := range r.NoSlots {
+		if !slices.Contains(items.WearSlots, v) {
+			return fmt.Errorf("unknown wear slot %q", v)
+		}
+	}
+	return validateSkills(r.Skills)
+}
+
+func (c Class) validate(key string) error {
+	if c.ID != key {
+		return fmt.Errorf("listed as %q but has ID %q", key, c.ID)
+	}
+	if c.HPPerLevel < 1 {
+		return fmt.Errorf("HP per level %d is less than 1", c.HPPerLevel)
+	}
+	if c.MPPerLevel < 0 {
+		return fmt.Errorf("MP per level %d is negative", c.MPPerLevel)
+	}
+	for _, v := range c.Weapons {
+		if !slices.Contains([]string{items.DAM_SLASH, items.DAM_PIERCE, items.DAM_BASH}, v) {
+			return fmt.Errorf("unknown damage type %q", v)
+		}
+	}
+	return validateSkills(c.Skills)
+}
+
+func validateSkills(list map[string]int) error {
+	for k := range list {
+		if _, ok := skills.Registry[k]; !ok {
+			return fmt.Errorf("unknown skill %q", k)
+		}
+	}
+	return nil
+}
+
+// Sorted lists the races in alphabetical order, for menus.
+func (rl RaceList) Sorted() []Race {
+	list := []Race{}
+	for _, v := range rl {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Sorted lists the classes in alphabetical order, for menus.
+func (cl ClassList) Sorted() []Class {
+	list := []Class{}
+	for _, v := range cl {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// String is how mods are shown in menus, like "+2 Str, -1 Dex".
+func (m Mods) String() string {
+	s := ""
+	for _, v := range []struct {
+		name string
+		mod  int
+	}{{"Str", m.Str}, {"Dex", m.Dex}, {"Vit", m.Vit}, {"Int", m.Int}, {"Wis", m.Wis}} {
+		if v.mod == 0 {
+			continue
+		}
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf("%+d %s", v.mod, v.name)
+	}
+	if s == "" {
+		return "no changes"
+	}
+	return s
+}
+
+// CanWield says whether the class can use a weapon that does a type of damage.
+func (c Class) CanWield(damType string) bool {
+	return len(c.Weapons) == 0 || slices.Contains(c.Weapons, damType)
+}
+
+// CanWear says whether the class can wear armor this heavy.
+func (c Class) CanWear(ac int) bool {
+	return c.MaxArmorAC == 0 || ac <= c.MaxArmorAC
+}
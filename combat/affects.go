@@ -0,0 +1,80 @@
+package combat
+
+// AffectInterval is how often, in ticks, affects that do damage over time do it.
+const AffectInterval = 30
+
+// An Affect is something changing a character or mob for a while, like being
+// blessed or poisoned. Both players and mobs keep a list of them, and their mods
+// are added in wherever the matching stats are worked out.
+type Affect struct {
+	// what caused it, like "bless", and only one of each name can be on anything
+	Name string `json:"Name"`
+	// how it's described to players, like "blessed"
+	Desc string `json:"Desc"`
+	// ticks left before it wears off
+	Duration int `json:"Duration"`
+	HitMod   int `json:"HitMod"`
+	DamMod   int `json:"DamMod"`
+	DefMod   int `json:"DefMod"`
+	// damage done every AffectInterval ticks, for things like poison
+	TickDamage int `json:"TickDamage"`
+	// what the one affected is told when it wears off
+	WearOff string `json:"WearOff"`
+}
+
+type Affects []Affect
+
+// Add puts an affect on. If there's one with the same name already it's replaced,
+// so casting something again refreshes it rather than stacking.
+func (a *Affects) Add(aff Affect) {
+	for i, v := range *a {
+		if v.Name == aff.Name {
+			(*a)[i] = aff
+			return
+		}
+	}
+	*a = append(*a, aff)
+}
+
+// Tick counts every affect down by one tick. It returns the ones that did damage
+// this tick, and the ones that have worn off, which are taken off.
+func (a *Affects) Tick() (hurt []Affect, worn []Affect) {
+	kept := Affects{}
+	for _, v := range *a {
+		v.Duration--
+		if v.TickDamage != 0 && v.Duration%AffectInterval == 0 {
+			hurt = append(hurt, v)
+		}
+		if v.Duration <= 0 {
+			worn = append(worn, v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	*a = kept
+	return hurt, worn
+}
+
+func (a Affects) HitMod() int {
+	mod := 0
+	for _, v := range a {
+		mod += v.HitMod
+	}
+	return mod
+}
+
+func (a Affects) DamMod() int {
+	mod := 0
+	for _, v := range a {
+		mod += v.DamMod
+	}
+	return mod
+}
+
+func (a Affects) DefMod() int {
+	mod := 0
+	for _, v := range a {
+		mod += v.DefMod
+	}
+	return mod
+}
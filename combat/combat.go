@@ -11,4 +11,5 @@ type Combatant interface {
 	GetDefense() int
 	GetHP() int
 	ExitCombat()
+	AddAffect(aff Affect)
 }
@@ -3,11 +3,13 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/lpbeast/ecbmud/ansi"
 	"github.com/lpbeast/ecbmud/chara"
+	"github.com/lpbeast/ecbmud/combat"
 	"github.com/lpbeast/ecbmud/items"
-	"github.com/lpbeast/ecbmud/mobs"
 	"github.com/lpbeast/ecbmud/rooms"
 )
 
@@ -25,7 +27,8 @@ func ParseCommand(in string) (*ParsedCommand, error) {
 	return &ParsedCommand{newCmd, args}, nil
 }
 
-// TODO: expand for parsing quantities and ordinals
+// ParseArgs splits up a command's arguments. Quantities, ordinals and ALL are
+// worked out from the tokens by parseTarget, since only some commands take them.
 func ParseArgs(in string) []Token {
 	// strings.Split seems to do something weird with an empty string
 	if len(in) == 0 {
@@ -47,10 +50,22 @@ func RunCommand(pc *ParsedCommand, ch *chara.ActiveCharacter) error {
 		return RunGoCommand(ParseArgs(pc.Arguments), ch)
 	case GET:
 		return RunGetCommand(ParseArgs(pc.Arguments), ch)
+	case PUT:
+		return RunPutCommand(ParseArgs(pc.Arguments), ch)
 	case DROP:
 		return RunDropCommand(ParseArgs(pc.Arguments), ch)
 	case INVENTORY:
 		return RunInvCommand(ch)
+	case EQUIPMENT:
+		return RunEquipmentCommand(ch)
+	case SCORE:
+		return RunScoreCommand(ch)
+	case WEAR:
+		return RunWearCommand(ParseArgs(pc.Arguments), ch, false)
+	case WIELD:
+		return RunWearCommand(ParseArgs(pc.Arguments), ch, true)
+	case REMOVE:
+		return RunRemoveCommand(ParseArgs(pc.Arguments), ch)
 	case DIRECTION:
 		args := []Token{{IDENT, pc.Command.Literal}}
 		return RunGoCommand(args, ch)
@@ -62,8 +77,14 @@ func RunCommand(pc *ParsedCommand, ch *chara.ActiveCharacter) error {
 		return RunQuitCommand(pc.Arguments, ch)
 	case KILL:
 		return RunKillCommand(ParseArgs(pc.Arguments), ch)
+	case CAST:
+		return RunCastCommand(pc.Arguments, ch)
+	case SKILL:
+		return RunSkillCommand(pc.Command.Literal, ParseArgs(pc.Arguments), ch)
 	case SAVE:
 		return RunSaveCommand(pc.Arguments, ch)
+	case COLOR:
+		return RunColorCommand(ParseArgs(pc.Arguments), ch)
 	default:
 		return fmt.Errorf("command %q not handled", pc.Command.Literal)
 	}
@@ -92,7 +113,7 @@ func RunLookCommand(args []Token, ch *chara.ActiveCharacter) error {
 		for _, v := range contents {
 			contStrings += v + "\n"
 		}
-		resp = fmt.Sprintf("%v\n    %v\nExits: %v\n", chLoc.Name, chLoc.Desc, chLoc.Exits)
+		resp = fmt.Sprintf("{CYAN}%v{x}\n    %v\n{green}Exits: %v{x}\n", chLoc.Name, chLoc.Desc, chLoc.Exits)
 		if pcAndMobStrings != "" {
 			resp += pcAndMobStrings
 		}
@@ -101,17 +122,31 @@ func RunLookCommand(args []Token, ch *chara.ActiveCharacter) error {
 		}
 	case ME:
 		resp = ch.CharData.Desc + "\n"
-	case IDENT:
-		if itm, err := items.AutoCompleteItems(args[0].Literal, ch.CharData.Inv); err == nil {
-			resp = fmt.Sprintf("%s\n", itm.Desc)
-		} else if itm, err := items.AutoCompleteItems(args[0].Literal, chLoc.Contents); err == nil {
-			resp = fmt.Sprintf("%s\n", itm.Desc)
-		} else if ch, err := chara.AutoCompletePCs(args[0].Literal, chLoc.PCs); err == nil {
-			resp = fmt.Sprintf("You look at %s.\n%s\n", ch.CharData.Name, ch.CharData.Desc)
-		} else if m, err := mobs.AutoCompleteMobs(args[0].Literal, chLoc.Mobs); err == nil {
-			resp = fmt.Sprintf("You look at %s.\n%s\n", m.Name, m.Desc)
+	case IN:
+		if len(args) < 2 {
+			resp = "Look in what?\n"
+		} else if cont, err := findContainer(args[1:], ch); err != nil {
+			resp = err.Error()
+		} else if len(cont.Contents) == 0 {
+			resp = fmt.Sprintf("The %s is empty.\n", cont.GetName())
 		} else {
-			resp = fmt.Sprintf("You don't see %v here.\n", args[0].Literal)
+			resp = fmt.Sprintf("The %s contains:\n", cont.GetName())
+			for _, v := range cont.ListContents() {
+				resp += v + "\n"
+			}
+		}
+	case IDENT, NUMBER:
+		spec, _ := parseTarget(args)
+		found := resolveTargets(spec, ch, SEARCH_INV|SEARCH_ROOM_ITEMS|SEARCH_PCS|SEARCH_MOBS)
+		switch {
+		case len(found) == 0:
+			resp = fmt.Sprintf("You don't see %v here.\n", spec.Keyword)
+		case found[0].Item != nil:
+			resp = fmt.Sprintf("%s\n", found[0].Item.GetDesc())
+		case found[0].PC != nil:
+			resp = fmt.Sprintf("You look at %s.\n%s\n", found[0].PC.CharData.Name, found[0].PC.CharData.Desc)
+		case found[0].Mob != nil:
+			resp = fmt.Sprintf("You look at %s.\n%s\n", found[0].Mob.Name, found[0].Mob.Desc)
 		}
 	default:
 		resp = fmt.Sprintf("You don't see %v here.\n", args[0].Literal)
@@ -147,42 +182,170 @@ func RunGetCommand(args []Token, ch *chara.ActiveCharacter) error {
 	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
 	if len(args) == 0 {
 		ch.ResponseChannel <- "Get what?\n"
+		ch.SendPrompt()
 		return nil
-	} else {
-		itm, err := items.AutoCompleteItems(args[0].Literal, chLoc.Contents)
-		if err != nil {
-			ch.ResponseChannel <- fmt.Sprintf("You don't see %q here.\n", args[0].Literal)
-			return err
+	}
+	spec, rest := parseTarget(args)
+	if len(rest) > 0 && rest[0].Type == FROM {
+		return runGetFromCommand(spec, rest[1:], ch)
+	}
+	found := resolveItems(spec, ch, SEARCH_ROOM_ITEMS)
+	if len(found) == 0 {
+		if spec.Keyword == "" {
+			ch.ResponseChannel <- "There's nothing here to pick up.\n"
 		} else {
-			chLoc.Remove(itm.ID)
-			ch.CharData.Insert(itm)
-			chMsg := fmt.Sprintf("You pick up the %s.\n", itm.Name)
-			otherMsg := fmt.Sprintf("%s picks up a %s.\n", ch.CharData.Name, itm.Name)
-			chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
-			return nil
+			ch.ResponseChannel <- fmt.Sprintf("You don't see %q here.\n", spec.Keyword)
+		}
+		ch.SendPrompt()
+		return nil
+	}
+	chMsg, otherMsg := "", ""
+	for _, itm := range found {
+		chLoc.Remove(itm)
+		ch.CharData.Insert(itm)
+		chMsg += fmt.Sprintf("You pick up the %s.\n", itm.GetName())
+		otherMsg += fmt.Sprintf("%s picks up a %s.\n", ch.CharData.Name, itm.GetName())
+	}
+	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+	return nil
+}
+
+// findContainer looks for a container the character is carrying, then for one in
+// the room. The error is the message to give the player.
+func findContainer(args []Token, ch *chara.ActiveCharacter) (*items.Instance, error) {
+	spec, _ := parseTarget(args)
+	found := resolveItems(spec, ch, SEARCH_INV|SEARCH_ROOM_ITEMS)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("You don't see %q here.\n", spec.Keyword)
+	}
+	if !found[0].IsContainer() {
+		return nil, fmt.Errorf("The %s isn't a container.\n", found[0].GetName())
+	}
+	return found[0], nil
+}
+
+func runGetFromCommand(spec TargetSpec, args []Token, ch *chara.ActiveCharacter) error {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	if len(args) == 0 {
+		ch.ResponseChannel <- "Get it from what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	cont, err := findContainer(args, ch)
+	if err != nil {
+		ch.ResponseChannel <- err.Error()
+		ch.SendPrompt()
+		return nil
+	}
+	found := matchItems(spec, cont.Contents)
+	if len(found) == 0 {
+		if spec.Keyword == "" {
+			ch.ResponseChannel <- fmt.Sprintf("The %s is empty.\n", cont.GetName())
+		} else {
+			ch.ResponseChannel <- fmt.Sprintf("There's no %q in the %s.\n", spec.Keyword, cont.GetName())
 		}
+		ch.SendPrompt()
+		return nil
+	}
+	chMsg, otherMsg := "", ""
+	for _, itm := range found {
+		cont.Remove(itm)
+		ch.CharData.Insert(itm)
+		chMsg += fmt.Sprintf("You get the %s from the %s.\n", itm.GetName(), cont.GetName())
+		otherMsg += fmt.Sprintf("%s gets a %s from a %s.\n", ch.CharData.Name, itm.GetName(), cont.GetName())
 	}
+	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+	return nil
+}
+
+// RunPutCommand handles PUT x IN y, or just PUT x y.
+func RunPutCommand(args []Token, ch *chara.ActiveCharacter) error {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	if len(args) == 0 {
+		ch.ResponseChannel <- "Put what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	spec, rest := parseTarget(args)
+	if len(rest) > 0 && rest[0].Type == IN {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		ch.ResponseChannel <- "Put it in what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	cont, err := findContainer(rest, ch)
+	if err != nil {
+		ch.ResponseChannel <- err.Error()
+		ch.SendPrompt()
+		return nil
+	}
+	found := resolveItems(spec, ch, SEARCH_INV)
+	if len(found) == 0 {
+		if spec.Keyword == "" {
+			ch.ResponseChannel <- "You aren't carrying anything.\n"
+		} else {
+			ch.ResponseChannel <- fmt.Sprintf("You don't have a %q.\n", spec.Keyword)
+		}
+		ch.SendPrompt()
+		return nil
+	}
+	chMsg, otherMsg := "", ""
+	for _, itm := range found {
+		if itm == cont {
+			// only worth mentioning if it was the one thing they asked for
+			if len(found) == 1 {
+				chMsg += fmt.Sprintf("You can't put the %s inside itself.\n", itm.GetName())
+			}
+			continue
+		}
+		if !cont.HasRoom() {
+			chMsg += fmt.Sprintf("The %s is full.\n", cont.GetName())
+			break
+		}
+		ch.CharData.Remove(itm)
+		cont.Insert(itm)
+		chMsg += fmt.Sprintf("You put the %s in the %s.\n", itm.GetName(), cont.GetName())
+		otherMsg += fmt.Sprintf("%s puts a %s in a %s.\n", ch.CharData.Name, itm.GetName(), cont.GetName())
+	}
+	if otherMsg == "" {
+		// nothing actually moved, so there's nothing for anyone else to see
+		ch.ResponseChannel <- chMsg
+		ch.SendPrompt()
+		return nil
+	}
+	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+	return nil
 }
 
 func RunDropCommand(args []Token, ch *chara.ActiveCharacter) error {
 	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
 	if len(args) == 0 {
-		ch.ResponseChannel <- "Get what?\n"
+		ch.ResponseChannel <- "Drop what?\n"
+		ch.SendPrompt()
 		return nil
-	} else {
-		itm, err := items.AutoCompleteItems(args[0].Literal, ch.CharData.Inv)
-		if err != nil {
-			ch.ResponseChannel <- fmt.Sprintf("You don't have a %q.\n", args[0].Literal)
-			return err
+	}
+	spec, _ := parseTarget(args)
+	found := resolveItems(spec, ch, SEARCH_INV)
+	if len(found) == 0 {
+		if spec.Keyword == "" {
+			ch.ResponseChannel <- "You aren't carrying anything.\n"
 		} else {
-			ch.CharData.Remove(itm.ID)
-			chLoc.Insert(itm)
-			chMsg := fmt.Sprintf("You drop the %s on the ground.\n", itm.Name)
-			otherMsg := fmt.Sprintf("%s drops a %s on the ground.\n", ch.CharData.Name, itm.Name)
-			chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
-			return nil
+			ch.ResponseChannel <- fmt.Sprintf("You don't have a %q.\n", spec.Keyword)
 		}
+		ch.SendPrompt()
+		return nil
+	}
+	chMsg, otherMsg := "", ""
+	for _, itm := range found {
+		ch.CharData.Remove(itm)
+		chLoc.Insert(itm)
+		chMsg += fmt.Sprintf("You drop the %s on the ground.\n", itm.GetName())
+		otherMsg += fmt.Sprintf("%s drops a %s on the ground.\n", ch.CharData.Name, itm.GetName())
 	}
+	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+	return nil
 }
 
 func RunInvCommand(ch *chara.ActiveCharacter) error {
@@ -202,15 +365,125 @@ func RunInvCommand(ch *chara.ActiveCharacter) error {
 	return nil
 }
 
+func RunScoreCommand(ch *chara.ActiveCharacter) error {
+	defer ch.SendPrompt()
+	ch.ResponseChannel <- ch.CharData.ScoreSheet()
+	return nil
+}
+
+func RunEquipmentCommand(ch *chara.ActiveCharacter) error {
+	defer ch.SendPrompt()
+	resp := ""
+	for _, s := range items.EquipSlots {
+		if itm := ch.CharData.Equipment[s]; itm != nil {
+			resp += fmt.Sprintf("%-10s %s\n", "<"+s+">", itm.GetName())
+		}
+	}
+	if resp == "" {
+		resp = "You aren't using any equipment.\n"
+	} else {
+		resp = "You are using:\n" + resp + "\n"
+	}
+	ch.ResponseChannel <- resp
+	return nil
+}
+
+// RunWearCommand handles both WEAR and WIELD, which only differ in what they'll
+// accept and what they say.
+func RunWearCommand(args []Token, ch *chara.ActiveCharacter, wield bool) error {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	verb := "Wear"
+	if wield {
+		verb = "Wield"
+	}
+	if len(args) == 0 {
+		ch.ResponseChannel <- verb + " what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	spec, _ := parseTarget(args)
+	found := resolveItems(spec, ch, SEARCH_INV)
+	if len(found) == 0 {
+		ch.ResponseChannel <- fmt.Sprintf("You don't have a %q.\n", spec.Keyword)
+		ch.SendPrompt()
+		return nil
+	}
+	itm := found[0]
+	slot := itm.Slot()
+	switch {
+	case slot == "":
+		ch.ResponseChannel <- fmt.Sprintf("You can't %s the %s.\n", strings.ToLower(verb), itm.GetName())
+	case slot == items.SLOT_WIELD && !wield:
+		ch.ResponseChannel <- fmt.Sprintf("The %s is a weapon. Try WIELD instead.\n", itm.GetName())
+	case slot != items.SLOT_WIELD && wield:
+		ch.ResponseChannel <- fmt.Sprintf("The %s isn't a weapon. Try WEAR instead.\n", itm.GetName())
+	case ch.CharData.CanUse(itm) != "":
+		ch.ResponseChannel <- ch.CharData.CanUse(itm) + "\n"
+	case ch.CharData.Equipment[slot] != nil:
+		ch.ResponseChannel <- fmt.Sprintf("You're already using the %s. REMOVE it first.\n", ch.CharData.Equipment[slot].GetName())
+	default:
+		ch.CharData.Remove(itm)
+		ch.CharData.Equipment[slot] = itm
+		var chMsg, otherMsg string
+		if wield {
+			chMsg = fmt.Sprintf("You wield the %s.\n", itm.GetName())
+			otherMsg = fmt.Sprintf("%s wields a %s.\n", ch.CharData.Name, itm.GetName())
+		} else {
+			chMsg = fmt.Sprintf("You wear the %s on your %s.\n", itm.GetName(), slot)
+			otherMsg = fmt.Sprintf("%s wears a %s on their %s.\n", ch.CharData.Name, itm.GetName(), slot)
+		}
+		chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+		return nil
+	}
+	ch.SendPrompt()
+	return nil
+}
+
+func RunRemoveCommand(args []Token, ch *chara.ActiveCharacter) error {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	if len(args) == 0 {
+		ch.ResponseChannel <- "Remove what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	spec, _ := parseTarget(args)
+	found := matchItems(spec, ch.CharData.Equipment.Worn())
+	if len(found) == 0 {
+		if spec.Keyword == "" {
+			ch.ResponseChannel <- "You aren't using any equipment.\n"
+		} else {
+			ch.ResponseChannel <- fmt.Sprintf("You aren't using a %q.\n", spec.Keyword)
+		}
+		ch.SendPrompt()
+		return nil
+	}
+	chMsg, otherMsg := "", ""
+	for _, itm := range found {
+		delete(ch.CharData.Equipment, itm.Slot())
+		ch.CharData.Insert(itm)
+		chMsg += fmt.Sprintf("You stop using the %s.\n", itm.GetName())
+		otherMsg += fmt.Sprintf("%s stops using a %s.\n", ch.CharData.Name, itm.GetName())
+	}
+	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+	return nil
+}
+
 func RunSayCommand(msg string, ch *chara.ActiveCharacter) error {
 	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
 	if msg == "" {
 		ch.ResponseChannel <- "Say what?\n"
 		return nil
 	} else {
-		chMsg := fmt.Sprintf("You say %q\n", msg)
-		otherMsg := fmt.Sprintf("\n%s says %q\n", ch.CharData.Name, msg)
+		chMsg := fmt.Sprintf("{yellow}You say %q{x}\n", ansi.Escape(msg))
+		otherMsg := fmt.Sprintf("\n{yellow}%s says %q{x}\n", ch.CharData.Name, ansi.Escape(msg))
 		chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
+		for _, v := range chLoc.PCs {
+			if v == ch {
+				v.SendComm("say", ch.CharData.Name, chMsg)
+			} else {
+				v.SendComm("say", ch.CharData.Name, otherMsg)
+			}
+		}
 		return nil
 	}
 }
@@ -234,10 +507,12 @@ func RunTellCommand(args string, ch *chara.ActiveCharacter) error {
 			ch.ResponseChannel <- "Could not find a player by that name.\n"
 			return nil
 		}
-		chMsg := fmt.Sprintf("You tell %s %q\n", recip.CharData.Name, msg)
-		otherMsg := fmt.Sprintf("\n%s tells you %q\n", ch.CharData.Name, msg)
+		chMsg := fmt.Sprintf("{magenta}You tell %s %q{x}\n", recip.CharData.Name, ansi.Escape(msg))
+		otherMsg := fmt.Sprintf("\n{magenta}%s tells you %q{x}\n", ch.CharData.Name, ansi.Escape(msg))
 		ch.ResponseChannel <- chMsg
 		recip.ResponseChannel <- otherMsg
+		ch.SendComm("tell", ch.CharData.Name, chMsg)
+		recip.SendComm("tell", ch.CharData.Name, otherMsg)
 		if recip != ch {
 			recip.SendPrompt()
 		}
@@ -256,29 +531,30 @@ func RunQuitCommand(args string, ch *chara.ActiveCharacter) error {
 	otherMsg := fmt.Sprintf("%s falls asleep.\n", ch.CharData.Name)
 	chLoc.LocalAnnouncePCMsg(ch, chMsg, otherMsg)
 	delete(chara.GlobalUserList, ch.CharData.Name)
-	for k, v := range chLoc.PCs {
-		if v == ch {
-			if k == len(chLoc.PCs)-1 {
-				chLoc.PCs = chLoc.PCs[:k]
-			} else {
-				chLoc.PCs = append(chLoc.PCs[:k], chLoc.PCs[k+1:]...)
-			}
-		}
-	}
+	chLoc.RemovePlayer(ch)
 	close(ch.ResponseChannel)
 	return nil
 }
 
 func RunKillCommand(args []Token, ch *chara.ActiveCharacter) error {
 	defer ch.SendPrompt()
-	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
 	if len(args) == 0 {
 		ch.ResponseChannel <- "Kill what?\n"
-	} else if m, err := mobs.AutoCompleteMobs(args[0].Literal, chLoc.Mobs); err == nil {
-		ch.EnterCombat(m)
-		m.EnterCombat(ch)
-	} else {
-		ch.ResponseChannel <- fmt.Sprintf("There is no %v here that you can kill.\n", args[0].Literal)
+		return nil
+	}
+	spec, _ := parseTarget(args)
+	found := resolveTargets(spec, ch, SEARCH_MOBS)
+	if len(found) == 0 && spec.Keyword == "" {
+		ch.ResponseChannel <- "There's nothing here that you can kill.\n"
+	} else if len(found) == 0 {
+		ch.ResponseChannel <- fmt.Sprintf("There is no %v here that you can kill.\n", spec.Keyword)
+	}
+	for _, t := range found {
+		// "kill all" again mid-fight shouldn't start a second fight with the same mob
+		if !slices.Contains(ch.TempInfo.Targets, combat.Combatant(t.Mob)) {
+			ch.EnterCombat(t.Mob)
+			t.Mob.EnterCombat(ch)
+		}
 	}
 
 	return nil
@@ -299,3 +575,28 @@ func RunSaveCommand(args string, ch *chara.ActiveCharacter) error {
 	}
 	return err
 }
+
+func RunColorCommand(args []Token, ch *chara.ActiveCharacter) error {
+	defer ch.SendPrompt()
+	if len(args) == 0 {
+		if ch.CharData.NoColor {
+			ch.ResponseChannel <- "Color is off. Type COLOR ON to turn it on.\n"
+		} else {
+			ch.ResponseChannel <- "Color is {GREEN}on{x}. Type COLOR OFF to turn it off.\n"
+		}
+		return nil
+	}
+	switch args[0].Literal {
+	case "on":
+		ch.CharData.NoColor = false
+		ch.SendColorPref()
+		ch.ResponseChannel <- "Color is now {GREEN}on{x}.\n"
+	case "off":
+		ch.CharData.NoColor = true
+		ch.SendColorPref()
+		ch.ResponseChannel <- "Color is now off.\n"
+	default:
+		ch.ResponseChannel <- "Type COLOR ON or COLOR OFF.\n"
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+
+	"github.com/lpbeast/ecbmud/chara"
+	"github.com/lpbeast/ecbmud/combat"
+	"github.com/lpbeast/ecbmud/rooms"
+	"github.com/lpbeast/ecbmud/skills"
+)
+
+// RunCastCommand casts a spell. The spell's name comes first, in quotes if it's
+// more than one word, though the first word of it is enough: "cast 'magic missile'
+// rat" or "cast magic rat".
+func RunCastCommand(args string, ch *chara.ActiveCharacter) error {
+	args = strings.ToLower(strings.TrimSpace(args))
+	var name, rest string
+	if args != "" && (args[0] == '\'' || args[0] == '"') {
+		name, rest, _ = strings.Cut(args[1:], args[:1])
+	} else {
+		name, rest, _ = strings.Cut(args, " ")
+	}
+	// an empty name would match every spell, so "cast ''" casts nothing
+	name = strings.TrimSpace(name)
+	if name == "" {
+		ch.ResponseChannel <- "Cast what?\n"
+		ch.SendPrompt()
+		return nil
+	}
+	s, ok := skills.Find(name, true)
+	if !ok || ch.CharData.Proficiency(s.Name) == 0 {
+		ch.ResponseChannel <- "You don't know any spell by that name.\n"
+		ch.SendPrompt()
+		return nil
+	}
+	return useSkill(s, ParseArgs(strings.TrimSpace(rest)), ch)
+}
+
+// RunSkillCommand handles the skills that are commands of their own, like BASH.
+func RunSkillCommand(stub string, args []Token, ch *chara.ActiveCharacter) error {
+	s, ok := skills.Find(stub, false)
+	if !ok {
+		return fmt.Errorf("no skill for command %q", stub)
+	}
+	if ch.CharData.Proficiency(s.Name) == 0 {
+		ch.ResponseChannel <- fmt.Sprintf("You don't know how to %s.\n", s.Name)
+		ch.SendPrompt()
+		return nil
+	}
+	return useSkill(s, args, ch)
+}
+
+// useSkill works out who a skill is being used on, checks the user can use it,
+// then uses it. Anything it kills is cleaned up by the server tick, the same as
+// for autoattacks, since that's where mobs get made dead.
+func useSkill(s *skills.Skill, args []Token, ch *chara.ActiveCharacter) error {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	verb := s.Name
+	if s.Spell {
+		verb = "cast " + s.Name
+	}
+	fail := func(msg string) error {
+		ch.ResponseChannel <- msg
+		ch.SendPrompt()
+		return nil
+	}
+
+	if s.Opener && len(ch.TempInfo.Targets) > 0 {
+		return fail(fmt.Sprintf("You can't %s while you're fighting.\n", s.Name))
+	}
+	if ch.CharData.MPCurrent < s.MP {
+		return fail(fmt.Sprintf("You don't have enough mana to %s.\n", verb))
+	}
+
+	var target combat.Combatant
+	var targetPC *chara.ActiveCharacter
+	switch s.Target {
+	case skills.TARGET_OFFENSIVE:
+		if len(args) == 0 {
+			if len(ch.TempInfo.Targets) == 0 {
+				return fail(fmt.Sprintf("%s whom?\n", strings.ToUpper(verb[:1])+verb[1:]))
+			}
+			target = ch.TempInfo.Targets[0]
+		} else {
+			spec, _ := parseTarget(args)
+			found := resolveTargets(spec, ch, SEARCH_MOBS)
+			if len(found) == 0 {
+				return fail(fmt.Sprintf("There is no %v here.\n", spec.Keyword))
+			}
+			target = found[0].Mob
+		}
+	case skills.TARGET_DEFENSIVE:
+		targetPC = ch
+		if len(args) > 0 && args[0].Type != ME {
+			spec, _ := parseTarget(args)
+			found := resolveTargets(spec, ch, SEARCH_PCS)
+			if len(found) == 0 {
+				return fail(fmt.Sprintf("There is nobody called %v here.\n", spec.Keyword))
+			}
+			targetPC = found[0].PC
+		}
+	case skills.TARGET_SELF:
+		targetPC = ch
+	}
+
+	ch.Cooldown = s.Cooldown
+	if target != nil && !slices.Contains(ch.TempInfo.Targets, target) {
+		ch.EnterCombat(target)
+		target.EnterCombat(ch)
+	}
+
+	chMsg := ""
+	if ch.CharData.Practice(s.Name) {
+		chMsg += fmt.Sprintf("{GREEN}You have become better at %s!{x}\n", s.Name)
+	}
+	if rand.Intn(100) >= ch.CharData.Proficiency(s.Name) {
+		// a failed spell still uses up some mana
+		ch.CharData.MPCurrent -= s.MP / 2
+		if s.Spell {
+			chMsg = "You lose your concentration.\n" + chMsg
+		} else {
+			chMsg = fmt.Sprintf("You try to %s, but get it wrong.\n", s.Name) + chMsg
+		}
+		chLoc.LocalAnnouncePCMsg(ch, "\n"+chMsg, fmt.Sprintf("\n%s tries to %s, but fails.\n", ch.GetName(), verb))
+		return nil
+	}
+	ch.CharData.MPCurrent -= s.MP
+
+	// targetMsg is for a PC on the receiving end of someone else's skill
+	var otherMsg, targetMsg string
+	amount := max(s.Dice.Roll()+ch.CharData.SkillBonus(s), 1)
+	switch s.Effect {
+	case skills.EFFECT_DAMAGE:
+		target.ReceiveDamage(amount)
+		chMsg = fmt.Sprintf("Your %s hits %s for {RED}%d{x} damage!\n", s.Name, target.GetName(), amount) + chMsg
+		otherMsg = fmt.Sprintf("%s's %s hits %s for %d damage.\n", ch.GetName(), s.Name, target.GetName(), amount)
+	case skills.EFFECT_HEAL:
+		targetPC.CharData.HPCurrent = min(targetPC.CharData.HPCurrent+amount, targetPC.CharData.HPMax)
+		if targetPC == ch {
+			chMsg = fmt.Sprintf("Your %s restores {GREEN}%d{x} HP.\n", s.Name, amount) + chMsg
+			otherMsg = fmt.Sprintf("%s looks better.\n", ch.GetName())
+		} else {
+			chMsg = fmt.Sprintf("Your %s restores {GREEN}%d{x} HP to %s.\n", s.Name, amount, targetPC.GetName()) + chMsg
+			otherMsg = fmt.Sprintf("%s's %s makes %s look better.\n", ch.GetName(), s.Name, targetPC.GetName())
+			targetMsg = fmt.Sprintf("%s's %s restores {GREEN}%d{x} HP to you.\n", ch.GetName(), s.Name, amount)
+		}
+	case skills.EFFECT_AFFECT:
+		if targetPC != nil {
+			target = targetPC
+		}
+		target.AddAffect(*s.Affect)
+		if target == combat.Combatant(ch) {
+			chMsg = fmt.Sprintf("You are now %s.\n", s.Affect.Desc) + chMsg
+		} else {
+			chMsg = fmt.Sprintf("%s is now %s.\n", target.GetName(), s.Affect.Desc) + chMsg
+			targetMsg = fmt.Sprintf("You are now %s.\n", s.Affect.Desc)
+		}
+		otherMsg = fmt.Sprintf("%s is now %s.\n", target.GetName(), s.Affect.Desc)
+	}
+	if targetPC != nil && targetPC != ch {
+		chLoc.LocalAnnounceTargetMsg(ch, targetPC, "\n"+chMsg, "\n"+targetMsg, "\n"+otherMsg)
+		return nil
+	}
+	chLoc.LocalAnnouncePCMsg(ch, "\n"+chMsg, "\n"+otherMsg)
+	return nil
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lpbeast/ecbmud/chara"
+	"github.com/lpbeast/ecbmud/items"
+	"github.com/lpbeast/ecbmud/mobs"
+	"github.com/lpbeast/ecbmud/rooms"
+)
+
+// A TargetSpec is which things a player means when they say "rat", "2.rat",
+// "3 eggs", "all.egg" or just "all".
+type TargetSpec struct {
+	// Keyword is "" for a plain "all", which matches anything
+	Keyword string
+	// Ordinal picks the Nth match, counting from 1
+	Ordinal int
+	// Count is how many to take, starting from the first match
+	Count int
+	All   bool
+}
+
+// parseTarget reads a target from the front of the arguments, and returns
+// whatever arguments are left after it.
+func parseTarget(args []Token) (TargetSpec, []Token) {
+	spec := TargetSpec{Ordinal: 1, Count: 1}
+	if len(args) == 0 {
+		return spec, args
+	}
+	switch args[0].Type {
+	case ALL:
+		spec.All = true
+		return spec, args[1:]
+	case NUMBER:
+		// "3 eggs"
+		if len(args) > 1 && args[1].Type == IDENT {
+			n, _ := strconv.Atoi(args[0].Literal)
+			spec.Count = max(n, 1)
+			spec.Keyword = args[1].Literal
+			return spec, args[2:]
+		}
+	}
+	spec.Keyword = args[0].Literal
+	if prefix, kw, ok := strings.Cut(args[0].Literal, "."); ok && kw != "" {
+		if prefix == "all" {
+			// "all.egg"
+			spec.All = true
+			spec.Keyword = kw
+		} else if n, err := strconv.Atoi(prefix); err == nil && n > 0 {
+			// "2.rat"
+			spec.Ordinal = n
+			spec.Keyword = kw
+		}
+	}
+	return spec, args[1:]
+}
+
+func (spec TargetSpec) plural() bool {
+	return spec.All || spec.Count > 1
+}
+
+// matches says whether any of a thing's keywords start with what the player typed.
+// Players will say "3 eggs" for things whose keyword is "egg", so if they're asking
+// for more than one, a trailing s is allowed too.
+func (spec TargetSpec) matches(keywords []string) bool {
+	if spec.Keyword == "" {
+		return true
+	}
+	for _, w := range keywords {
+		if strings.HasPrefix(w, spec.Keyword) {
+			return true
+		}
+		if spec.plural() && strings.HasPrefix(w, strings.TrimSuffix(spec.Keyword, "s")) {
+			return true
+		}
+	}
+	return false
+}
+
+// pick narrows down everything that matched to the ones the player asked for.
+func pick[T any](spec TargetSpec, found []T) []T {
+	switch {
+	case spec.All:
+		return found
+	case spec.Count > 1:
+		return found[:min(spec.Count, len(found))]
+	case spec.Ordinal <= len(found):
+		return found[spec.Ordinal-1 : spec.Ordinal]
+	}
+	return nil
+}
+
+// matchItems finds the items in a list that the player asked for.
+func matchItems(spec TargetSpec, list []*items.Instance) []*items.Instance {
+	found := []*items.Instance{}
+	for _, v := range list {
+		if spec.matches(v.GetKeywords()) {
+			found = append(found, v)
+		}
+	}
+	return pick(spec, found)
+}
+
+// Places resolveTargets can look
+const (
+	SEARCH_INV = 1 << iota
+	SEARCH_ROOM_ITEMS
+	SEARCH_PCS
+	SEARCH_MOBS
+)
+
+// A Target is one thing a player's words resolved to. Only one of the fields is set.
+type Target struct {
+	Item *items.Instance
+	PC   *chara.ActiveCharacter
+	Mob  *mobs.Mob
+}
+
+// resolveTargets finds what a player means, looking in the places asked for, always
+// in the order: inventory, items in the room, other players, mobs. Ordinals and
+// counts go across all of them in that order, so if you're carrying a rat and
+// there's one in the room too, "2.rat" is the one in the room.
+func resolveTargets(spec TargetSpec, ch *chara.ActiveCharacter, where int) []Target {
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	// gather everything that matches, then pick from the whole list
+	found := []Target{}
+	if where&SEARCH_INV != 0 {
+		for _, v := range ch.CharData.Inv {
+			if spec.matches(v.GetKeywords()) {
+				found = append(found, Target{Item: v})
+			}
+		}
+	}
+	if where&SEARCH_ROOM_ITEMS != 0 {
+		for _, v := range chLoc.Contents {
+			if spec.matches(v.GetKeywords()) {
+				found = append(found, Target{Item: v})
+			}
+		}
+	}
+	if where&SEARCH_PCS != 0 {
+		for _, v := range chLoc.PCs {
+			if spec.matches([]string{strings.ToLower(v.CharData.Name)}) {
+				found = append(found, Target{PC: v})
+			}
+		}
+	}
+	if where&SEARCH_MOBS != 0 {
+		for _, v := range chLoc.Mobs {
+			if spec.matches(v.Keywords) {
+				found = append(found, Target{Mob: v})
+			}
+		}
+	}
+	return pick(spec, found)
+}
+
+// resolveItems is resolveTargets for commands that only want items.
+func resolveItems(spec TargetSpec, ch *chara.ActiveCharacter, where int) []*items.Instance {
+	found := []*items.Instance{}
+	for _, v := range resolveTargets(spec, ch, where) {
+		if v.Item != nil {
+			found = append(found, v.Item)
+		}
+	}
+	return found
+}
@@ -1,7 +1,10 @@
 package commands
 
 import (
+	"strconv"
 	"strings"
+
+	"github.com/lpbeast/ecbmud/skills"
 )
 
 type TokenType string
@@ -31,11 +34,19 @@ const (
 	SAY  = "SAY"
 	TELL = "TELL"
 	KILL = "KILL"
+	CAST = "CAST"
+	// any skill that's used as a command of its own
+	SKILL = "SKILL"
+
+	WEAR   = "WEAR"
+	WIELD  = "WIELD"
+	REMOVE = "REMOVE"
 
 	SCORE     = "SCORE"
 	INVENTORY = "INVENTORY"
 	EQUIPMENT = "EQUIPMENT"
 	SAVE      = "SAVE"
+	COLOR     = "COLOR"
 
 	PERIOD    = "."
 	DQUOTE    = "\""
@@ -87,6 +98,12 @@ var keywords = map[string]TokenType{
 	"t":    TELL,
 	"kill": KILL,
 	"k":    KILL,
+	"cast": CAST,
+	"c":    CAST,
+
+	"wear":   WEAR,
+	"wield":  WIELD,
+	"remove": REMOVE,
 
 	"score":     SCORE,
 	"inventory": INVENTORY,
@@ -96,6 +113,8 @@ var keywords = map[string]TokenType{
 	"inv":       INVENTORY,
 	"eq":        EQUIPMENT,
 	"save":      SAVE,
+	"color":     COLOR,
+	"colour":    COLOR,
 }
 
 var keywordsList = []string{
@@ -119,10 +138,23 @@ var keywordsList = []string{
 	"score",
 	"inventory",
 	"equipment",
+	"wear",
+	"wield",
+	"remove",
 	"save",
+	"color",
 	"say",
 	"tell",
 	"kill",
+	"cast",
+}
+
+// skills that aren't spells are commands too, so those get added from the registry
+func init() {
+	for _, v := range skills.Commands() {
+		keywords[v] = SKILL
+		keywordsList = append(keywordsList, v)
+	}
 }
 
 var specialIdents = map[string]TokenType{
@@ -163,6 +195,9 @@ func lookupIdent(ident string) Token {
 	if tok, ok := specialIdents[ident]; ok {
 		return Token{tok, ident}
 	}
+	if _, err := strconv.Atoi(ident); err == nil {
+		return Token{NUMBER, ident}
+	}
 	return Token{IDENT, ident}
 }
 
@@ -1,23 +1,29 @@
 package main
 
 import (
-	"bufio"
-	"crypto/sha512"
-	"encoding/csv"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/lpbeast/ecbmud/chara"
+	"github.com/lpbeast/ecbmud/classes"
 	"github.com/lpbeast/ecbmud/combat"
 	"github.com/lpbeast/ecbmud/commands"
 	"github.com/lpbeast/ecbmud/items"
 	"github.com/lpbeast/ecbmud/rooms"
+	"github.com/lpbeast/ecbmud/store"
+	"github.com/lpbeast/ecbmud/telnet"
+	"github.com/lpbeast/ecbmud/web"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -33,156 +39,284 @@ type ctrlMsg struct {
 	returnChannel chan string
 }
 
+// clientConn is what the connection handler needs from a player's connection,
+// whether that's telnet or the browser client over WebSocket.
+type clientConn interface {
+	ReadLine() (string, error)
+	WriteString(s string) (int, error)
+	Close() error
+}
+
 // createConnection sets up a handler for I/O for a given connection and character
-func createConnection(c net.Conn, servChan chan inputMsg, ctrlChan chan ctrlMsg) {
+func createConnection(c clientConn, servChan chan inputMsg, ctrlChan chan ctrlMsg) {
 	ch := make(chan string)
-	ic := make(chan string, 20)
-	loginChan := make(chan string)
-	sc := bufio.NewScanner(c)
-	loggedIn := false
+	// quit tells the reader goroutine to give up if it's waiting to hand over a line
+	// after the handler has finished
+	quit := make(chan struct{})
+	loginDone := make(chan struct{})
 	name := ""
 
-	io.WriteString(c, "Welcome to Endless Crystal Blue MUD\n")
-
-	go chara.DoLogin(ch, loginChan)
-
-	go func(c net.Conn, inputChan chan string) {
-		for sc.Scan() {
-			line := sc.Text()
-			// fmt.Printf("DEBUG Handling input line %q.\n", line)
-			for len(inputChan) >= cap(inputChan) {
-				time.Sleep(100 * time.Millisecond)
+	defer func() {
+		close(quit)
+		if tc, ok := c.(*telnet.Conn); ok {
+			if st := tc.CompressionStats(); st.Raw > 0 {
+				fmt.Printf("LOG %v MCCP2 for %q: %d bytes sent as %d, saved %d\n", time.Now(), name, st.Raw, st.Compressed, st.Saved())
 			}
-			inputChan <- line
 		}
-	}(c, ic)
+		c.Close()
+	}()
+
+	if tc, ok := c.(*telnet.Conn); ok {
+		tc.Negotiate()
+	}
+	c.WriteString("Welcome to Endless Crystal Blue MUD\n")
+
+	ic := readLines(c, quit)
 
-	for !loggedIn {
+	// the login goroutine reads input straight from ic until it's finished
+	go func() {
+		chara.DoLogin(ch, ic)
+		close(loginDone)
+	}()
+
+	for name == "" {
 		select {
 		case response := <-ch:
 			// fmt.Printf("DEBUG Handler received control message: %q\n", response)
-			if response[:8] == "Success:" {
+			if strings.HasPrefix(response, "Success:") {
 				name = response[8:]
-				loggedIn = true
 			} else {
-				io.WriteString(c, response)
+				c.WriteString(response)
 			}
-		case input := <-ic:
-			loginChan <- input
-		default:
+		case <-loginDone:
+			// DoLogin only finishes without a name if the connection was lost
+			if name == "" {
+				return
+			}
+		case <-shuttingDown:
+			c.WriteString("\nThe server is shutting down.\n")
+			return
 		}
 	}
 	// fmt.Printf("DEBUG Handler for %q sending LOGIN\n", name)
 	eventMsg := ctrlMsg{name, "LOGIN", ch}
 	ctrlChan <- eventMsg
+	relayPlayer(c, name, ic, ch, servChan, ctrlChan)
+}
 
-	connected := true
-	for connected {
+// readLines starts the goroutine that reads lines from a connection. The channel it
+// returns gets closed when the connection is lost.
+func readLines(c clientConn, quit chan struct{}) chan string {
+	ic := make(chan string, 20)
+	go func() {
+		defer close(ic)
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			// fmt.Printf("DEBUG Handling input line %q.\n", line)
+			select {
+			case ic <- line:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return ic
+}
+
+// relayPlayer passes a logged in player's input to the server and the server's
+// output back to them, until the server closes ch.
+func relayPlayer(c clientConn, name string, ic chan string, ch chan string, servChan chan inputMsg, ctrlChan chan ctrlMsg) {
+	for {
 		select {
-		case input := <-ic:
+		case input, ok := <-ic:
+			if !ok {
+				// the connection is gone, but the server may still be sending to ch,
+				// so tell it and then keep emptying ch until it gets closed
+				ctrlChan <- ctrlMsg{name, "LINKDEAD", ch}
+				ic = nil
+				continue
+			}
 			msgForServer := inputMsg{name, input}
 			servChan <- msgForServer
 		case resp, ok := <-ch:
 			if !ok {
-				connected = false
-			} else {
-				io.WriteString(c, resp)
+				return
+			}
+			if ic != nil {
+				c.WriteString(resp)
 			}
-		default:
 		}
 	}
+}
 
-	c.Close()
+// logOut saves a character and takes them out of the game without any of the
+// ceremony of QUIT, for when they've been link-dead too long.
+func logOut(ch *chara.ActiveCharacter) {
+	err := ch.Save()
+	if err != nil {
+		log.Printf("Unable to save %q: %s\n", ch.GetName(), err)
+	}
+	chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+	chLoc.RemovePlayer(ch)
+	delete(chara.GlobalUserList, ch.GetName())
+	chLoc.LocalAnnounce(fmt.Sprintf("\n%s fades away.\n", ch.GetName()))
+	close(ch.ResponseChannel)
 }
 
 func serverCleanup() {
 	fmt.Printf("Shutting down server.\n")
 }
 
-func checkCharFile(lfname string) error {
-	// if the character list does not exist, create it, and go through generating an
-	// admin character. Admin character has no special powers yet but will in future.
-	// If the file exists but is empty, no character will be created, and any desired
-	// admin characters will need to be created by the normal process and promoted
-	// manually.
-	_, err := os.Stat(lfname)
-	if errors.Is(err, os.ErrNotExist) {
-		fmt.Printf("Welcome to Endless Crystal Blue MUD setup.\n")
-		fmt.Printf("Enter a name for your admin character.\n")
-		var name, pw1, pw2 string
-		fmt.Scanln(&name)
-		name = cases.Title(language.English).String(name)
-		for pw1 != pw2 || pw1 == "" || pw2 == "" {
-			fmt.Printf("Enter a password for this character.\n")
-			fmt.Scanln(&pw1)
-			fmt.Printf("Enter it again to confirm.\n")
-			fmt.Scanln(&pw2)
-		}
-		fmt.Print("Creating character file with initial character.\n")
-
-		lf, err := os.OpenFile(lfname, os.O_CREATE|os.O_WRONLY, 0600)
+// importOldSaves fills an empty store from older kinds of save. Characters from
+// before there were accounts get accounts made for them next to their files in dir,
+// then a store of any other kind gets everything in dir copied into it. It reports
+// whether there was anything to import.
+func importOldSaves(dst chara.Store, kind string, dir string, charListFile string) (bool, error) {
+	src := dst
+	if kind != "file" {
+		fs, err := store.NewFileStore(dir)
 		if err != nil {
-			return err
+			return false, err
 		}
-		defer lf.Close()
+		src = fs
+	}
+	migrated := false
+	if _, err := os.Stat(charListFile); err == nil {
+		fmt.Printf("Moving characters from %s to accounts.\n", charListFile)
+		if err := chara.MigrateCharList(src, charListFile); err != nil {
+			return false, err
+		}
+		migrated = true
+	}
+	if src == dst {
+		return migrated, nil
+	}
+	accts, err := src.ListAccounts()
+	if err != nil || len(accts) == 0 {
+		return false, err
+	}
+	fmt.Printf("Copying accounts and characters from files into %s store.\n", kind)
+	return true, store.Copy(dst, src)
+}
 
-		hasher := sha512.New()
-		pwHash := fmt.Sprintf("%x", hasher.Sum([]byte(pw1)))
-		newCharEntry := []string{name, pwHash}
+func checkAccounts() error {
+	// if the store has no accounts yet, set it up from any older saves. If there
+	// weren't any, this is a new server, so go through generating an admin account
+	// and character.
+	// Any other admin accounts will need to be created by the normal process and
+	// promoted manually by adding the admin role.
+	accts, err := chara.GlobalStore.ListAccounts()
+	if err != nil || len(accts) > 0 {
+		return err
+	}
+	found, err := importOldSaves(chara.GlobalStore, *storeType, "chara", chara.CharListFile)
+	if err != nil || found {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
-		w := csv.NewWriter(lf)
-		if err := w.Write(newCharEntry); err != nil {
-			return err
-		}
-		w.Flush()
+	fmt.Printf("Welcome to Endless Crystal Blue MUD setup.\n")
+	fmt.Printf("Enter a name for your admin account and character.\n")
+	var name, pw1, pw2 string
+	fmt.Scanln(&name)
+	name = cases.Title(language.English).String(name)
+	for pw1 != pw2 || pw1 == "" || pw2 == "" {
+		fmt.Printf("Enter a password for this account.\n")
+		fmt.Scanln(&pw1)
+		fmt.Printf("Enter it again to confirm.\n")
+		fmt.Scanln(&pw2)
+	}
+	fmt.Print("Creating initial account and character.\n")
 
-		charFileName := "chara" + string(os.PathSeparator) + name + ".json"
-		cf, err := os.OpenFile(charFileName, os.O_CREATE|os.O_WRONLY, 0600)
-		if err != nil {
-			log.Fatal(err)
-		}
-		newCharSheet := chara.CharSheet{
-			Name:      name,
-			Zone:      "z1000",
-			Location:  "r1000",
-			Desc:      "A formless being.\n",
-			HPCurrent: 100,
-			HPMax:     100,
-			MPCurrent: 100,
-			MPMax:     100,
-			AtkRoll:   0,
-			DamRoll:   0,
-			Inv:       []items.Item{},
-		}
-		jChar, err := json.MarshalIndent(newCharSheet, "", "\t")
-		if err != nil {
-			log.Fatal(err)
-		}
-		cf.Write(jChar)
-		return nil
+	pwHash, err := chara.HashPassword(pw1)
+	if err != nil {
+		return err
 	}
-	return err
+	err = chara.CreateAccount(chara.Account{
+		Name:       name,
+		PWHash:     pwHash,
+		Characters: []string{},
+		Roles:      []string{chara.ROLE_ADMIN},
+	})
+	if err != nil {
+		return err
+	}
+	return chara.AddCharacter(name, name, classes.DefaultRace, classes.DefaultClass)
 }
 
 var tickCounter = 0
 
+var (
+	httpAddr      = flag.String("http", "", "address to serve the browser client and WebSocket gateway on, e.g. :8080 (off if not set)")
+	tlsAddr       = flag.String("tls", "", "address for encrypted telnet connections, e.g. :4443 (off if not set)")
+	tlsCert       = flag.String("tls-cert", "cert.pem", "certificate file for the TLS listener")
+	tlsKey        = flag.String("tls-key", "key.pem", "private key file for the TLS listener")
+	tlsSelfSigned = flag.Bool("tls-self-signed", false, "generate a self-signed certificate and key for testing if they don't exist")
+	maxChars      = flag.Int("max-chars", 5, "how many characters each account can have")
+	storeType     = flag.String("store", "file", "where to keep accounts and characters: file (JSON files in chara/) or bolt (a single database file)")
+	backups       = flag.Int("backups", 3, "how many previous saves of each file the file store keeps")
+	dbPath        = flag.String("db", "chara/ecb.db", "database file for the bolt store")
+	worldSnapshot = flag.String("world-snapshot", "", "file to keep the state of the world in across reboots, e.g. world.json (off if not set)")
+	autosave      = flag.Duration("autosave", 5*time.Minute, "how often each logged in character, and the world snapshot, is saved (0 to turn off)")
+	linkDeadGrace = flag.Duration("linkdead-grace", 5*time.Minute, "how long a character whose connection drops stays in the game before being saved and removed")
+)
+
+// acceptConnections hands each new connection on a listener to the server.
+func acceptConnections(l net.Listener, connChan chan clientConn) {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			// the server is shutting down
+			return
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		connChan <- telnet.NewConn(conn)
+	}
+}
+
 func main() {
+	flag.Parse()
 	defer serverCleanup()
 
-	err := checkCharFile(chara.CharListFile)
+	chara.MaxCharacters = *maxChars
+	store.Backups = *backups
+	var err error
+	chara.GlobalStore, err = store.Open(*storeType, "chara", *dbPath)
 	if err != nil {
-		log.Fatalf("Unable to find or create characters file: %s\n", err.Error())
+		log.Fatalf("Unable to open %s store: %s\n", *storeType, err.Error())
+	}
+	defer chara.GlobalStore.Close()
+	// item templates have to be loaded before any characters are, since older saves
+	// get their items made into instances while they're loaded, including when
+	// checkAccounts copies them into a new store
+	fmt.Printf("Loading item templates.\n")
+	err = items.LoadItems()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if items.GlobalItemList == nil {
+		log.Fatal("No items loaded.\n")
+	}
+	// the admin character made at setup needs a race and class
+	fmt.Printf("Loading races and classes.\n")
+	err = classes.LoadClasses()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = checkAccounts()
+	if err != nil {
+		log.Fatalf("Unable to find or create accounts: %s\n", err.Error())
 	}
 
 	runWorld := true
 	// servChan is for the connection handlers to send user input to the main server
 	servChan := make(chan inputMsg, 400)
-	// connChan is for the goroutine that listens for new connections to tell the server
+	// connChan is for the goroutines that listen for new connections to tell the server
 	// that there's a new connection, and to hand the connection over to the connection handler
-	connChan := make(chan net.Conn, 20)
+	connChan := make(chan clientConn, 20)
 	// ctrlChan is for the connection handlers to send control messages like LOGIN and QUIT
 	// to the main server
 	ctrlChan := make(chan ctrlMsg, 20)
@@ -193,26 +327,37 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer l.Close()
+	listeners := []io.Closer{l}
 
-	go func(connChan chan net.Conn) {
-		fmt.Printf("Connection dispatcher started.\n")
-		for {
-			conn, err := l.Accept()
-			if err != nil {
-				log.Fatal(err)
-			}
-			connChan <- conn
-		}
-	}(connChan)
+	fmt.Printf("Connection dispatcher started.\n")
+	go acceptConnections(l, connChan)
 
-	fmt.Printf("Loading item templates.\n")
-	err = items.LoadItems()
-	if err != nil {
-		log.Fatal(err)
+	if *tlsAddr != "" {
+		tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey, *tlsSelfSigned)
+		if err != nil {
+			log.Fatalf("Unable to set up TLS: %s\n", err.Error())
+		}
+		tl, err := tls.Listen("tcp", *tlsAddr, tlsConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listeners = append(listeners, tl)
+		fmt.Printf("TLS listening on %s.\n", *tlsAddr)
+		go acceptConnections(tl, connChan)
 	}
-	if items.GlobalItemList == nil {
-		log.Fatal("No rooms loaded.\n")
+
+	if *httpAddr != "" {
+		wh := web.Handler(func(c *web.Conn) {
+			connChan <- c
+		})
+		srv := &http.Server{Addr: *httpAddr, Handler: wh}
+		listeners = append(listeners, srv)
+		go func() {
+			fmt.Printf("Web client listening on %s.\n", *httpAddr)
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
 	}
 
 	fmt.Printf("Loading zones.\n")
@@ -223,6 +368,13 @@ func main() {
 	if rooms.GlobalZoneList == nil {
 		log.Fatal("No rooms loaded.\n")
 	}
+	err = loadWorldSnapshot()
+	if err != nil {
+		log.Fatalf("Unable to restore world snapshot: %s\n", err.Error())
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	fmt.Printf("Server starting.\n")
 	for runWorld {
@@ -232,7 +384,11 @@ func main() {
 			select {
 			case conn := <-connChan:
 				// fmt.Printf("DEBUG Received connection.\n")
-				go createConnection(conn, servChan, ctrlChan)
+				handlers.Add(1)
+				go func() {
+					defer handlers.Done()
+					createConnection(conn, servChan, ctrlChan)
+				}()
 			case incoming := <-ctrlChan:
 				// fmt.Printf("DEBUG Received control message.\n")
 				switch incoming.event {
@@ -240,40 +396,62 @@ func main() {
 					fmt.Printf("LOG %v Server received LOGIN for %q\n", time.Now(), incoming.chara)
 					// TODO: pull this into a function
 					if chara.GlobalUserList[incoming.chara] == nil {
-						charFile := "chara" + string(os.PathSeparator) + incoming.chara + ".json"
-						charSheet := chara.CharSheet{}
-						cf, err := os.ReadFile(charFile)
+						charSheet, err := chara.GlobalStore.LoadCharacter(incoming.chara)
 						if err != nil {
-							incoming.returnChannel <- fmt.Sprintf("Could not read character file for %q.\n", incoming.chara)
-							close(incoming.returnChannel)
-						}
-						err = json.Unmarshal(cf, &charSheet)
-						if err != nil {
-							incoming.returnChannel <- fmt.Sprintf("error unmarshaling JSON: %s", err)
+							fmt.Printf("LOG %v Could not load character %q: %s\n", time.Now(), incoming.chara, err)
+							incoming.returnChannel <- fmt.Sprintf("Could not load character %q.\n", incoming.chara)
 							close(incoming.returnChannel)
+							break
 						}
 
 						transients := chara.Transients{Position: chara.STANDING, Targets: []combat.Combatant{}}
 
 						charToLogIn := chara.ActiveCharacter{ResponseChannel: incoming.returnChannel, Cooldown: 0, CharData: charSheet, TempInfo: transients, IncomingCmds: []string{}}
 						chara.GlobalUserList[incoming.chara] = &charToLogIn
+						charToLogIn.SendColorPref()
 						incoming.returnChannel <- fmt.Sprintf("Welcome to Endless Crystal Blue MUD, %s.\n", incoming.chara)
 						pcZone := charToLogIn.CharData.Zone
 						pcRoom := charToLogIn.CharData.Location
 						rooms.GlobalZoneList[pcZone].Rooms[pcRoom].PCs = append(rooms.GlobalZoneList[pcZone].Rooms[pcRoom].PCs, &charToLogIn)
 						rooms.GlobalZoneList[pcZone].Rooms[pcRoom].LocalAnnounce(fmt.Sprintf("%s wakes up.\n", charToLogIn.CharData.Name))
+						rooms.GlobalZoneList[pcZone].Rooms[pcRoom].SendRoomInfo(&charToLogIn)
 						commands.RunLookCommand([]commands.Token{}, &charToLogIn)
 					} else {
-						incoming.returnChannel <- "Character already logged in.\n"
-						chara.GlobalUserList[incoming.chara].ResponseChannel <- "Duplicate login attempt.\n"
-						close(incoming.returnChannel)
+						// DoLogin has already checked the password, so this is the owner
+						// coming back after losing their connection, or logging in from
+						// somewhere else. Either way the new connection takes over.
+						ch := chara.GlobalUserList[incoming.chara]
+						wasLinkDead := ch.TempInfo.LinkDead
+						ch.Reconnect(incoming.returnChannel)
+						ch.SendColorPref()
+						ch.ResponseChannel <- fmt.Sprintf("Welcome back to Endless Crystal Blue MUD, %s.\n", incoming.chara)
+						chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+						if wasLinkDead {
+							chLoc.LocalAnnouncePCMsg(ch, "", fmt.Sprintf("\n%s has reconnected.\n", ch.GetName()))
+						}
+						chLoc.SendRoomInfo(ch)
+						commands.RunLookCommand([]commands.Token{}, ch)
+					}
+				case "LINKDEAD":
+					fmt.Printf("LOG %v Server received LINKDEAD for %q\n", time.Now(), incoming.chara)
+					// make sure it's this connection's character. If the character has already
+					// quit, or been taken over by a newer connection, the channel has been
+					// closed already and there's nothing to do.
+					if ch := chara.GlobalUserList[incoming.chara]; ch != nil && ch.ResponseChannel == incoming.returnChannel {
+						ch.TempInfo.LinkDead = true
+						ch.TempInfo.LinkDeadTicks = 0
+						chLoc := rooms.GlobalZoneList[ch.CharData.Zone].Rooms[ch.CharData.Location]
+						chLoc.LocalAnnouncePCMsg(ch, "", fmt.Sprintf("\n%s has lost their link.\n", ch.GetName()))
 					}
 				default:
 					log.Fatalf("Unexpected control message %q\n", incoming.event)
 				}
 			case incoming := <-servChan:
 				// fmt.Printf("DEBUG Received input message on tick %v.\n", tickCounter)
-				chara.GlobalUserList[incoming.chara].IncomingCmds = append(chara.GlobalUserList[incoming.chara].IncomingCmds, incoming.input)
+				// input can still arrive from a connection after its character has quit
+				if ch := chara.GlobalUserList[incoming.chara]; ch != nil {
+					ch.IncomingCmds = append(ch.IncomingCmds, incoming.input)
+				}
 			default:
 			}
 		}
@@ -282,5 +460,13 @@ func main() {
 		// active mobs" but that can wait till I get mobs working at all and know what
 		// I have to work with there.
 		doServerTick()
+
+		select {
+		case sig := <-sigChan:
+			fmt.Printf("LOG %v Received %v.\n", time.Now(), sig)
+			runWorld = false
+		default:
+		}
 	}
+	shutDown(listeners, connChan, ctrlChan)
 }
@@ -0,0 +1,185 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lpbeast/ecbmud/store"
+)
+
+// idleConnections is how many players are sat doing nothing
+const idleConnections = 200
+
+const tickLength = 100 * time.Millisecond
+
+// idleConn is a connection whose player never types anything. ReadLine blocks until
+// it's closed, like a socket with nothing coming in.
+type idleConn struct {
+	closed chan struct{}
+	once   sync.Once
+	writes atomic.Int64
+}
+
+func newIdleConn() *idleConn {
+	return &idleConn{closed: make(chan struct{})}
+}
+
+func (c *idleConn) ReadLine() (string, error) {
+	<-c.closed
+	return "", io.EOF
+}
+
+func (c *idleConn) WriteString(s string) (int, error) {
+	c.writes.Add(1)
+	return len(s), nil
+}
+
+func (c *idleConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// cpuTime is how much CPU the whole test process has used so far.
+func cpuTime(t testing.TB) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// startIdle connects n idle players waiting at the login prompt and n idle players
+// who are logged in, and returns a function that disconnects them all and waits for
+// their handlers to finish.
+func startIdle(t testing.TB, n int) func() {
+	servChan := make(chan inputMsg, 400)
+	ctrlChan := make(chan ctrlMsg, 20)
+	// stands in for the server, which closes a player's channel once they've gone
+	// link-dead
+	go func() {
+		for msg := range ctrlChan {
+			if msg.event == "LINKDEAD" {
+				close(msg.returnChannel)
+			}
+		}
+	}()
+
+	conns := []*idleConn{}
+	var handlers sync.WaitGroup
+	for i := 0; i < n; i++ {
+		login, playing := newIdleConn(), newIdleConn()
+		conns = append(conns, login, playing)
+		handlers.Add(2)
+		go func() {
+			defer handlers.Done()
+			createConnection(login, servChan, ctrlChan)
+		}()
+		go func() {
+			defer handlers.Done()
+			quit := make(chan struct{})
+			defer close(quit)
+			relayPlayer(playing, "Idler", readLines(playing, quit), make(chan string), servChan, ctrlChan)
+		}()
+	}
+
+	// let everyone get as far as waiting for input, which for the ones logging in is
+	// after the welcome and the account prompt
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; i < len(conns); i += 2 {
+		for conns[i].writes.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	time.Sleep(tickLength)
+
+	return func() {
+		for _, c := range conns {
+			c.Close()
+		}
+		handlers.Wait()
+		close(ctrlChan)
+	}
+}
+
+// TestIdleConnections checks idle players don't keep their connection handlers
+// busy. Handlers that spin waiting for input would use a whole core each second.
+func TestIdleConnections(t *testing.T) {
+	stop := startIdle(t, idleConnections)
+	defer stop()
+
+	ticks := 10
+	before := cpuTime(t)
+	time.Sleep(time.Duration(ticks) * tickLength)
+	used := cpuTime(t) - before
+	t.Logf("%d idle connections used %v of CPU over %d ticks", 2*idleConnections, used, ticks)
+	if limit := time.Duration(ticks) * tickLength / 20; used > limit {
+		t.Errorf("idle connections used %v of CPU over %d ticks, want under %v", used, ticks, limit)
+	}
+}
+
+// BenchmarkIdleConnections reports how much CPU idle connections use each tick.
+func BenchmarkIdleConnections(b *testing.B) {
+	stop := startIdle(b, idleConnections)
+	defer stop()
+
+	b.ResetTimer()
+	before := cpuTime(b)
+	for i := 0; i < b.N; i++ {
+		time.Sleep(tickLength)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(cpuTime(b)-before)/float64(b.N), "cpu-ns/tick")
+}
+
+// TestImportOldSavesIntoBolt starts a bolt store on a server from before accounts,
+// which has its characters in a list and their saves in files.
+func TestImportOldSavesIntoBolt(t *testing.T) {
+	dir := t.TempDir()
+	charList := filepath.Join(dir, "charlist.csv")
+	if err := os.WriteFile(charList, []byte("Oldtimer,$2a$04$notarealhash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	save := `{"Name": "Oldtimer", "Zone": "z1000", "Location": "r1001", "HPCurrent": 50, "HPMax": 100, "Inv": []}`
+	if err := os.WriteFile(filepath.Join(dir, "Oldtimer.json"), []byte(save), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.NewBoltStore(filepath.Join(dir, "chara.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	found, err := importOldSaves(db, "bolt", dir, charList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("didn't find anything to import")
+	}
+	acct, err := db.LoadAccount("Oldtimer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.PWHash != "$2a$04$notarealhash" || !slices.Equal(acct.Characters, []string{"Oldtimer"}) {
+		t.Errorf("account is %+v, want Oldtimer's password and character", acct)
+	}
+	cs, err := db.LoadCharacter("Oldtimer")
+	if err != nil {
+		t.Fatalf("character wasn't copied into the store: %s", err)
+	}
+	if cs.Location != "r1001" || cs.HPCurrent != 50 {
+		t.Errorf("character is in %s with %d HP, want r1001 with 50", cs.Location, cs.HPCurrent)
+	}
+	if _, err := os.Stat(charList); !os.IsNotExist(err) {
+		t.Error("the character list wasn't moved out of the way")
+	}
+}
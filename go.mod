@@ -2,6 +2,12 @@ module github.com/lpbeast/ecbmud
 
 go 1.21.0
 
-require golang.org/x/text v0.13.0
+require (
+	github.com/google/uuid v1.3.1
+	go.etcd.io/bbolt v1.3.8
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
 
-require github.com/google/uuid v1.3.1
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,37 @@
+package items
+
+import "fmt"
+
+// Container items carry their contents around with them, so they're saved along
+// with whoever or wherever has them.
+
+func (i *Instance) IsContainer() bool {
+	return i.Template().Container != nil
+}
+
+// HasRoom says whether there's space for one more item inside.
+func (i *Instance) HasRoom() bool {
+	c := i.Template().Container
+	return c != nil && len(i.Contents) < c.Capacity
+}
+
+func (i *Instance) ListContents() []string {
+	itemList := []string{}
+	for _, v := range i.Contents {
+		itemList = append(itemList, v.GetName())
+	}
+	return itemList
+}
+
+func (i *Instance) Insert(itm *Instance) {
+	i.Contents = append(i.Contents, itm)
+}
+
+func (i *Instance) Remove(itm *Instance) error {
+	var err error
+	i.Contents, err = RemoveInstance(i.Contents, itm)
+	if err != nil {
+		return fmt.Errorf("%s: %w", i.GetName(), err)
+	}
+	return nil
+}
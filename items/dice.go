@@ -0,0 +1,57 @@
+package items
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+// Dice is a roll like 2d6+1, written that way in the data files.
+type Dice struct {
+	Num   int
+	Sides int
+	Bonus int
+}
+
+func ParseDice(s string) (Dice, error) {
+	d := Dice{}
+	n, err := fmt.Sscanf(s, "%dd%d%d", &d.Num, &d.Sides, &d.Bonus)
+	// the bonus is optional, and Sscanf reads its sign as part of the number. It
+	// also ignores anything left over, so check it comes back out the same.
+	if n < 2 || (err != nil && n != 2) || d.String() != s {
+		return Dice{}, fmt.Errorf("bad dice %q, should be like 1d8 or 2d6+1", s)
+	}
+	if d.Num < 1 || d.Sides < 1 {
+		return Dice{}, fmt.Errorf("bad dice %q, need at least one die with at least one side", s)
+	}
+	return d, nil
+}
+
+func (d Dice) Roll() int {
+	total := d.Bonus
+	for i := 0; i < d.Num; i++ {
+		total += rand.Intn(d.Sides) + 1
+	}
+	return total
+}
+
+func (d Dice) String() string {
+	if d.Bonus == 0 {
+		return fmt.Sprintf("%dd%d", d.Num, d.Sides)
+	}
+	return fmt.Sprintf("%dd%d%+d", d.Num, d.Sides, d.Bonus)
+}
+
+func (d *Dice) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	*d, err = ParseDice(s)
+	return err
+}
+
+func (d Dice) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
@@ -0,0 +1,52 @@
+package items
+
+// SLOT_WIELD is where a weapon goes. Everything else is worn in one of WearSlots.
+const SLOT_WIELD = "wield"
+
+// EquipSlots is every slot, in the order they're listed
+var EquipSlots = append([]string{SLOT_WIELD}, WearSlots...)
+
+// Equipment is what a character or mob has worn or wielded, by slot.
+type Equipment map[string]*Instance
+
+// Weapon returns the wielded weapon's template data, or nil if there isn't one.
+func (eq Equipment) Weapon() *WeaponData {
+	if w := eq[SLOT_WIELD]; w != nil {
+		return w.Template().Weapon
+	}
+	return nil
+}
+
+// AC adds up the armor class of everything worn.
+func (eq Equipment) AC() int {
+	ac := 0
+	for _, v := range eq {
+		if a := v.Template().Armor; a != nil {
+			ac += a.AC
+		}
+	}
+	return ac
+}
+
+// Slot returns where an item would go, or "" if it can't be worn or wielded.
+func (i *Instance) Slot() string {
+	t := i.Template()
+	switch {
+	case t.Weapon != nil:
+		return SLOT_WIELD
+	case t.Armor != nil:
+		return t.Armor.Slot
+	}
+	return ""
+}
+
+// Worn lists what's being worn and wielded, in the order of EquipSlots.
+func (eq Equipment) Worn() []*Instance {
+	list := []*Instance{}
+	for _, s := range EquipSlots {
+		if eq[s] != nil {
+			list = append(list, eq[s])
+		}
+	}
+	return list
+}
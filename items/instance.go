@@ -0,0 +1,75 @@
+package items
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lpbeast/ecbmud/ansi"
+)
+
+// An Instance is one particular item in the world. What kind of thing it is comes
+// from its template in GlobalItemList, and anything that can be different between
+// two of the same thing is kept here.
+type Instance struct {
+	UUID       string `json:"UUID"`
+	TemplateID string `json:"TemplateID"`
+	// a custom name replaces the template's, eg for engraved or renamed items
+	Name      string `json:"Name,omitempty"`
+	Condition int    `json:"Condition"`
+	Charges   int    `json:"Charges"`
+	// what's inside, if it's a container
+	Contents []*Instance `json:"Contents,omitempty"`
+}
+
+// MaxCondition is the condition of an undamaged item.
+const MaxCondition = 100
+
+// NewInstance makes a brand new item from a template.
+func NewInstance(templateID string) (*Instance, error) {
+	t, ok := GlobalItemList[templateID]
+	if !ok {
+		return nil, fmt.Errorf("no item template %q", templateID)
+	}
+	return &Instance{
+		UUID:       uuid.New().String(),
+		TemplateID: templateID,
+		Condition:  MaxCondition,
+		Charges:    t.Charges,
+	}, nil
+}
+
+func (i *Instance) Template() Item {
+	return GlobalItemList[i.TemplateID]
+}
+
+func (i *Instance) GetName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return i.Template().Name
+}
+
+// GetKeywords returns the template's keywords, plus the words of a custom name so
+// that players can refer to it by what it's called.
+func (i *Instance) GetKeywords() []string {
+	kw := i.Template().Keywords
+	if i.Name != "" {
+		kw = append(strings.Fields(strings.ToLower(ansi.Strip(i.Name))), kw...)
+	}
+	return kw
+}
+
+func (i *Instance) GetDesc() string {
+	desc := i.Template().Desc
+	switch {
+	case i.Condition >= MaxCondition:
+	case i.Condition >= 75:
+		desc += "\nIt has a few scratches."
+	case i.Condition >= 40:
+		desc += "\nIt looks rather worn."
+	default:
+		desc += "\nIt's falling apart."
+	}
+	return desc
+}
@@ -2,22 +2,87 @@ package items
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"slices"
 )
 
 type Container interface {
 	ListContents() []string
-	Insert(itm string)
-	Remove(itm string) error
+	Insert(itm *Instance)
+	Remove(itm *Instance) error
 }
 
+// Item types
+const (
+	TYPE_MISC      = "misc"
+	TYPE_WEAPON    = "weapon"
+	TYPE_ARMOR     = "armor"
+	TYPE_CONTAINER = "container"
+	TYPE_FOOD      = "food"
+	TYPE_LIGHT     = "light"
+	TYPE_KEY       = "key"
+)
+
+// Damage types
+const (
+	DAM_SLASH  = "slash"
+	DAM_PIERCE = "pierce"
+	DAM_BASH   = "bash"
+)
+
+// Wear slots, in the order they're listed
+var WearSlots = []string{"head", "neck", "body", "about", "arms", "wrists", "hands", "finger", "waist", "legs", "feet", "shield"}
+
+// An Item is a template for a kind of item. The items actually in the world are
+// Instances of them.
+// Each type of item has its own block of data, and an item only has the one that
+// goes with its Type, which LoadItems checks.
 type Item struct {
 	ID       string   `json:"ID"`
 	Name     string   `json:"Name"`
 	Keywords []string `json:"Keywords"`
 	Desc     string   `json:"Desc"`
+	Type     string   `json:"Type"`
+	// how many charges a new one starts with, for things like wands
+	Charges int `json:"Charges"`
+
+	Weapon    *WeaponData    `json:"Weapon,omitempty"`
+	Armor     *ArmorData     `json:"Armor,omitempty"`
+	Container *ContainerData `json:"Container,omitempty"`
+	Food      *FoodData      `json:"Food,omitempty"`
+	Light     *LightData     `json:"Light,omitempty"`
+	Key       *KeyData       `json:"Key,omitempty"`
+}
+
+type WeaponData struct {
+	Dice    Dice   `json:"Dice"`
+	DamType string `json:"DamType"`
+}
+
+type ArmorData struct {
+	AC   int    `json:"AC"`
+	Slot string `json:"Slot"`
+}
+
+type ContainerData struct {
+	// how many items fit inside
+	Capacity int `json:"Capacity"`
+}
+
+type FoodData struct {
+	Nutrition int `json:"Nutrition"`
+}
+
+type LightData struct {
+	// in ticks, or -1 for one that never goes out
+	Duration int `json:"Duration"`
+}
+
+type KeyData struct {
+	// matches the LockKey of the doors it opens
+	KeyID string `json:"KeyID"`
 }
 
 type ItemList map[string]Item
@@ -41,16 +106,76 @@ func LoadItems() error {
 		fmt.Printf("error unmarshaling JSON: %s", err)
 		return err
 	}
+
+	errs := []error{}
+	for k, v := range GlobalItemList {
+		if v.Type == "" {
+			v.Type = TYPE_MISC
+			GlobalItemList[k] = v
+		}
+		if err := v.validate(k); err != nil {
+			errs = append(errs, fmt.Errorf("item %s: %w", k, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t Item) validate(key string) error {
+	if t.ID != key {
+		return fmt.Errorf("listed as %q but has ID %q", key, t.ID)
+	}
+	// exactly the block for the item's type, and no others
+	blocks := map[string]bool{
+		TYPE_WEAPON:    t.Weapon != nil,
+		TYPE_ARMOR:     t.Armor != nil,
+		TYPE_CONTAINER: t.Container != nil,
+		TYPE_FOOD:      t.Food != nil,
+		TYPE_LIGHT:     t.Light != nil,
+		TYPE_KEY:       t.Key != nil,
+	}
+	if _, ok := blocks[t.Type]; !ok && t.Type != TYPE_MISC {
+		return fmt.Errorf("unknown type %q", t.Type)
+	}
+	for typ, present := range blocks {
+		if typ == t.Type && !present {
+			return fmt.Errorf("is a %s but has no %s data", t.Type, typ)
+		}
+		if typ != t.Type && present {
+			return fmt.Errorf("is a %s but has %s data", t.Type, typ)
+		}
+	}
+
+	switch t.Type {
+	case TYPE_WEAPON:
+		if !slices.Contains([]string{DAM_SLASH, DAM_PIERCE, DAM_BASH}, t.Weapon.DamType) {
+			return fmt.Errorf("unknown damage type %q", t.Weapon.DamType)
+		}
+	case TYPE_ARMOR:
+		if !slices.Contains(WearSlots, t.Armor.Slot) {
+			return fmt.Errorf("unknown wear slot %q", t.Armor.Slot)
+		}
+	case TYPE_CONTAINER:
+		if t.Container.Capacity < 1 {
+			return fmt.Errorf("container capacity %d is less than 1", t.Container.Capacity)
+		}
+	case TYPE_LIGHT:
+		if t.Light.Duration < -1 || t.Light.Duration == 0 {
+			return fmt.Errorf("light duration %d should be positive, or -1 for forever", t.Light.Duration)
+		}
+	case TYPE_KEY:
+		if t.Key.KeyID == "" {
+			return fmt.Errorf("key has no KeyID")
+		}
+	}
 	return nil
 }
 
-func AutoCompleteItems(stub string, items []Item) (Item, error) {
-	for _, v := range items {
-		for _, w := range v.Keywords {
-			if strings.HasPrefix(w, stub) {
-				return v, nil
-			}
+// RemoveInstance takes one particular item out of a list of items.
+func RemoveInstance(list []*Instance, itm *Instance) ([]*Instance, error) {
+	for k, v := range list {
+		if v == itm {
+			return append(list[:k], list[k+1:]...), nil
 		}
 	}
-	return Item{}, fmt.Errorf("not found: %q", stub)
+	return list, fmt.Errorf("not found: %q", itm.UUID)
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"strings"
 
 	"github.com/google/uuid"
 	"github.com/lpbeast/ecbmud/combat"
@@ -24,10 +23,13 @@ type Mob struct {
 	Desc     string   `json:"Desc"`
 	StartLoc string   `json:"StartLoc"`
 	ContList []string `json:"ContList"`
-	Contents []items.Item
-	UUID     string
-	Zone     string
-	Loc      string
+	// template IDs of what the mob has equipped
+	EqList    []string `json:"EqList"`
+	Contents  []*items.Instance
+	Equipment items.Equipment
+	UUID      string
+	Zone      string
+	Loc       string
 
 	HPCurrent int `json:"HPCurrent"`
 	HPMax     int `json:"HPMax"`
@@ -35,6 +37,10 @@ type Mob struct {
 	MPMax     int `json:"MPMax"`
 	AtkRoll   int `json:"AtkRoll"`
 	DamRoll   int `json:"DamRoll"`
+	// experience for killing it, shared between everyone fighting it
+	XP int `json:"XP"`
+	// buffs and debuffs, which go when it dies
+	Affects combat.Affects `json:"Affects"`
 
 	TempInfo Transients
 }
@@ -60,20 +66,20 @@ func LoadMobs(zoneID string) (MobList, error) {
 		v.UUID = uuid.New().String()
 		v.Zone = zoneID
 		v.Loc = v.StartLoc
-		fmt.Printf("loaded mob: %s: %s\n", v.Name, v.UUID)
-	}
-	return ml, nil
-}
-
-func AutoCompleteMobs(stub string, mobs []*Mob) (*Mob, error) {
-	for _, v := range mobs {
-		for _, w := range v.Keywords {
-			if strings.HasPrefix(w, stub) {
-				return v, nil
+		v.Equipment = items.Equipment{}
+		for _, inum := range v.EqList {
+			itm, err := items.NewInstance(inum)
+			if err != nil {
+				return nil, fmt.Errorf("mob %s: %w", v.ID, err)
+			}
+			if itm.Slot() == "" {
+				return nil, fmt.Errorf("mob %s: can't equip %s, it's not a weapon or armor", v.ID, inum)
 			}
+			v.Equipment[itm.Slot()] = itm
 		}
+		fmt.Printf("loaded mob: %s: %s\n", v.Name, v.UUID)
 	}
-	return nil, fmt.Errorf("not found: %q", stub)
+	return ml, nil
 }
 
 func (m *Mob) EnterCombat(target combat.Combatant) {
@@ -86,10 +92,14 @@ func (m *Mob) DoAutoAttack() (string, string) {
 	chAtkMsg := fmt.Sprintf("\n%s swings at you.\n", m.GetName())
 	otherAtkMsg := fmt.Sprintf("\n%s swings at %s.\n", m.GetName(), m.TempInfo.Targets[0].GetName())
 	tn := 99 - m.TempInfo.Targets[0].GetDefense()
-	if rand.Intn(100)+m.AtkRoll <= tn {
+	if rand.Intn(100)-m.AtkRoll-m.Affects.HitMod() <= tn {
 		dmg := rand.Intn(10) + 1 + m.DamRoll
+		if w := m.Equipment.Weapon(); w != nil {
+			dmg = w.Dice.Roll() + m.DamRoll
+		}
+		dmg = max(dmg+m.Affects.DamMod(), 1)
 		m.TempInfo.Targets[0].ReceiveDamage(dmg)
-		chAtkMsg += fmt.Sprintf("%s hits you for %d damage!\n", m.GetName(), dmg)
+		chAtkMsg += fmt.Sprintf("%s hits you for {RED}%d{x} damage!\n", m.GetName(), dmg)
 		otherAtkMsg += fmt.Sprintf("%s hits %s for %d damage.\n", m.GetName(), m.TempInfo.Targets[0].GetName(), dmg)
 	} else {
 		chAtkMsg += fmt.Sprintf("%s misses you.\n", m.GetName())
@@ -107,7 +117,12 @@ func (m *Mob) GetName() string {
 }
 
 func (m *Mob) GetDefense() int {
-	return 0
+	return m.Equipment.AC() + m.Affects.DefMod()
+}
+
+// AddAffect puts an affect on the mob, replacing any with the same name.
+func (m *Mob) AddAffect(aff combat.Affect) {
+	m.Affects.Add(aff)
 }
 
 func (m *Mob) GetHP() int {
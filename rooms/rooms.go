@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/lpbeast/ecbmud/ansi"
 	"github.com/lpbeast/ecbmud/chara"
 	"github.com/lpbeast/ecbmud/items"
 	"github.com/lpbeast/ecbmud/mobs"
@@ -26,7 +27,7 @@ type Room struct {
 	Exits    map[string]TransDest `json:"Exits"`
 	ContList []string             `json:"ContList"`
 	MobList  []string             `json:"MobList"`
-	Contents []items.Item
+	Contents []*items.Instance
 	Mobs     []*mobs.Mob
 	PCs      []*chara.ActiveCharacter
 }
@@ -54,7 +55,12 @@ func LoadRooms(zone string, ml mobs.MobList) (RoomList, error) {
 		v.Zone = zone
 		// temporary for testing, rooms will be unlikely to just have items lying around
 		for _, inum := range v.ContList {
-			v.Contents = append(v.Contents, items.GlobalItemList[inum])
+			itm, err := items.NewInstance(inum)
+			if err != nil {
+				fmt.Printf("error loading contents of room %s: %s.\n", v.ID, err)
+				continue
+			}
+			v.Contents = append(v.Contents, itm)
 		}
 	}
 
@@ -68,27 +74,19 @@ func LoadRooms(zone string, ml mobs.MobList) (RoomList, error) {
 func (r *Room) ListContents() []string {
 	itemList := []string{}
 	for _, v := range r.Contents {
-		itemList = append(itemList, v.Name)
+		itemList = append(itemList, v.GetName())
 	}
 	return itemList
 }
 
-func (r *Room) Insert(itm items.Item) {
+func (r *Room) Insert(itm *items.Instance) {
 	r.Contents = append(r.Contents, itm)
 }
 
-func (r *Room) Remove(itm string) error {
-	for k, v := range r.Contents {
-		if v.ID == itm {
-			if k == len(r.Contents)-1 {
-				r.Contents = r.Contents[:k]
-			} else {
-				r.Contents = append(r.Contents[:k], r.Contents[k+1:]...)
-			}
-			return nil
-		}
-	}
-	return fmt.Errorf("not found: %q", itm)
+func (r *Room) Remove(itm *items.Instance) error {
+	var err error
+	r.Contents, err = items.RemoveInstance(r.Contents, itm)
+	return err
 }
 
 func (r *Room) LocalAnnounce(msg string) {
@@ -109,6 +107,38 @@ func (r *Room) LocalAnnouncePCMsg(ch *chara.ActiveCharacter, chMsg string, other
 	}
 }
 
+// LocalAnnounceTargetMsg is LocalAnnouncePCMsg for when ch does something to another
+// PC, who gets targetMsg instead of the message for everyone else.
+func (r *Room) LocalAnnounceTargetMsg(ch *chara.ActiveCharacter, target *chara.ActiveCharacter, chMsg string, targetMsg string, otherMsg string) {
+	for _, v := range r.PCs {
+		switch v {
+		case ch:
+			v.ResponseChannel <- chMsg
+		case target:
+			v.ResponseChannel <- targetMsg
+		default:
+			v.ResponseChannel <- otherMsg
+		}
+		v.SendPrompt()
+	}
+}
+
+// SendRoomInfo sends the room's details over GMCP for client-side mappers.
+func (r *Room) SendRoomInfo(ch *chara.ActiveCharacter) {
+	exits := map[string]string{}
+	for k, v := range r.Exits {
+		exits[k] = v.Room
+	}
+	info := struct {
+		Num   string            `json:"num"`
+		Name  string            `json:"name"`
+		Zone  string            `json:"zone"`
+		Area  string            `json:"area"`
+		Exits map[string]string `json:"exits"`
+	}{r.ID, ansi.Strip(r.Name), r.Zone, GlobalZoneList[r.Zone].Name, exits}
+	ch.SendGMCP("Room.Info", info)
+}
+
 func (r *Room) TransferPlayer(ch *chara.ActiveCharacter, destZone string, destRoom string, announce bool) {
 	// Players can't cuurently leave a room while they're fighting, but in future they will
 	// be able to flee, recall out, possibly be summoned, and also there may be bugs, so this is
@@ -179,6 +209,36 @@ func (r *Room) TransferPlayer(ch *chara.ActiveCharacter, destZone string, destRo
 	GlobalZoneList[destZone].Rooms[destRoom].PCs = append(GlobalZoneList[destZone].Rooms[destRoom].PCs, ch)
 	ch.CharData.Zone = destZone
 	ch.CharData.Location = destRoom
+	GlobalZoneList[destZone].Rooms[destRoom].SendRoomInfo(ch)
+}
+
+// RemovePlayer takes a character out of the room entirely, for when they leave the
+// game rather than going somewhere else. Any mobs fighting them stop.
+func (r *Room) RemovePlayer(ch *chara.ActiveCharacter) {
+	for _, m := range r.Mobs {
+		for i, t := range m.TempInfo.Targets {
+			if t == ch {
+				if i == len(m.TempInfo.Targets)-1 {
+					m.TempInfo.Targets = m.TempInfo.Targets[:i]
+				} else {
+					m.TempInfo.Targets = append(m.TempInfo.Targets[:i], m.TempInfo.Targets[i+1:]...)
+				}
+				if len(m.TempInfo.Targets) == 0 {
+					m.ExitCombat()
+				}
+			}
+		}
+	}
+	ch.ExitCombat()
+	for k, v := range r.PCs {
+		if v == ch {
+			if k == len(r.PCs)-1 {
+				r.PCs = r.PCs[:k]
+			} else {
+				r.PCs = append(r.PCs[:k], r.PCs[k+1:]...)
+			}
+		}
+	}
 }
 
 // Mobs do not wander into other zones.
@@ -235,17 +295,18 @@ func (r *Room) TransferMob(m *mobs.Mob, destRoom string, announce bool) {
 	}
 
 	// remove mob from old room, add them to new room
-	for k, v := range r.Mobs {
-		if v == m {
-			if k == len(r.Mobs)-1 {
-				r.Mobs = r.Mobs[:k]
-			} else {
-				r.Mobs = append(r.Mobs[:k], r.Mobs[k+1:]...)
-			}
-		}
-	}
+	r.removeMob(m)
 	GlobalZoneList[m.Zone].Rooms[destRoom].Mobs = append(GlobalZoneList[m.Zone].Rooms[destRoom].Mobs, m)
 	// update mob's location as well as room moblists or it tries to leave from the same
 	// room over and over and multiplies
 	m.Loc = destRoom
 }
+
+func (r *Room) removeMob(m *mobs.Mob) {
+	for k, v := range r.Mobs {
+		if v == m {
+			r.Mobs = append(r.Mobs[:k], r.Mobs[k+1:]...)
+			return
+		}
+	}
+}
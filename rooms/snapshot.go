@@ -0,0 +1,114 @@
+package rooms
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lpbeast/ecbmud/combat"
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// A WorldSnapshot is everything about the world that changes while the server is
+// running and would otherwise be reset from the zone files on a reboot. Players
+// aren't in it, since they're saved separately.
+type WorldSnapshot struct {
+	Saved time.Time               `json:"Saved"`
+	Zones map[string]ZoneSnapshot `json:"Zones"`
+}
+
+type ZoneSnapshot struct {
+	RepopCtr int `json:"RepopCtr"`
+	// what's lying on the floor of each room, by room ID
+	Rooms map[string][]*items.Instance `json:"Rooms"`
+	// by mob ID, both living and dead
+	Mobs map[string]MobSnapshot `json:"Mobs"`
+}
+
+type MobSnapshot struct {
+	Loc       string            `json:"Loc"`
+	HPCurrent int               `json:"HPCurrent"`
+	MPCurrent int               `json:"MPCurrent"`
+	Contents  []*items.Instance `json:"Contents"`
+	Affects   combat.Affects    `json:"Affects"`
+	Dead      bool              `json:"Dead"`
+}
+
+// Snapshot records the current state of every zone.
+func Snapshot() WorldSnapshot {
+	ws := WorldSnapshot{Saved: time.Now(), Zones: map[string]ZoneSnapshot{}}
+	for zid, z := range GlobalZoneList {
+		zs := ZoneSnapshot{
+			RepopCtr: z.RepopCtr,
+			Rooms:    map[string][]*items.Instance{},
+			Mobs:     map[string]MobSnapshot{},
+		}
+		for rid, r := range z.Rooms {
+			zs.Rooms[rid] = r.Contents
+		}
+		for _, m := range z.ActiveMobs {
+			zs.Mobs[m.ID] = MobSnapshot{Loc: m.Loc, HPCurrent: m.HPCurrent, MPCurrent: m.MPCurrent, Contents: m.Contents, Affects: m.Affects}
+		}
+		for _, m := range z.DeadMobs {
+			zs.Mobs[m.ID] = MobSnapshot{Loc: m.Loc, Contents: m.Contents, Dead: true}
+		}
+		ws.Zones[zid] = zs
+	}
+	return ws
+}
+
+// RestoreSnapshot puts the world back the way it was when the snapshot was taken.
+// It has to be called after the zones are loaded and before anyone logs in. Zones,
+// rooms and mobs that have been taken out of the data files since are skipped, and
+// any that have been added keep the state they were loaded with.
+func RestoreSnapshot(ws WorldSnapshot) {
+	for zid, zs := range ws.Zones {
+		z := GlobalZoneList[zid]
+		if z == nil {
+			fmt.Printf("LOG %v Zone %q from world snapshot no longer exists.\n", time.Now(), zid)
+			continue
+		}
+		z.RepopCtr = zs.RepopCtr
+		for rid, contents := range zs.Rooms {
+			if r := z.Rooms[rid]; r != nil {
+				r.Contents = knownItems(contents)
+			}
+		}
+		for mid, ms := range zs.Mobs {
+			m := z.ActiveMobs[mid]
+			if m == nil {
+				continue
+			}
+			r := z.Rooms[m.Loc]
+			if ms.Dead {
+				r.removeMob(m)
+				delete(z.ActiveMobs, mid)
+				z.DeadMobs[mid] = m
+				continue
+			}
+			if dest := z.Rooms[ms.Loc]; dest != nil && dest != r {
+				r.removeMob(m)
+				dest.Mobs = append(dest.Mobs, m)
+				m.Loc = ms.Loc
+			}
+			m.HPCurrent = ms.HPCurrent
+			m.MPCurrent = ms.MPCurrent
+			m.Contents = knownItems(ms.Contents)
+			m.Affects = ms.Affects
+		}
+	}
+}
+
+// knownItems drops any items whose templates have been taken out of the data files
+// since the snapshot was taken.
+func knownItems(list []*items.Instance) []*items.Instance {
+	known := []*items.Instance{}
+	for _, v := range list {
+		if _, ok := items.GlobalItemList[v.TemplateID]; ok {
+			v.Contents = knownItems(v.Contents)
+			known = append(known, v)
+		} else {
+			fmt.Printf("LOG %v Dropping item %s from world snapshot, no template %q.\n", time.Now(), v.UUID, v.TemplateID)
+		}
+	}
+	return known
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lpbeast/ecbmud/chara"
+)
+
+const shutdownMsg = "\nThe server is shutting down. Your character has been saved.\n"
+
+// shuttingDown is closed when the server starts shutting down, so that connection
+// handlers still at the login prompt know to give up.
+var shuttingDown = make(chan struct{})
+
+// handlers counts the running connection handlers, so shutdown can wait for them
+// to finish sending everyone their last messages.
+var handlers sync.WaitGroup
+
+// shutDown stops taking new connections, then saves everyone and disconnects them.
+func shutDown(listeners []io.Closer, connChan chan clientConn, ctrlChan chan ctrlMsg) {
+	fmt.Printf("LOG %v Shutting down, saving %d characters.\n", time.Now(), len(chara.GlobalUserList))
+	for _, l := range listeners {
+		l.Close()
+	}
+	close(shuttingDown)
+
+	// connections and logins that came in after the last tick never got handled
+	for len(connChan) > 0 {
+		c := <-connChan
+		c.WriteString("\nThe server is shutting down.\n")
+		c.Close()
+	}
+	for len(ctrlChan) > 0 {
+		incoming := <-ctrlChan
+		if incoming.event == "LOGIN" {
+			incoming.returnChannel <- "\nThe server is shutting down.\n"
+			close(incoming.returnChannel)
+		}
+	}
+
+	for _, v := range chara.GlobalUserList {
+		if err := v.Save(); err != nil {
+			log.Printf("Unable to save %q: %s\n", v.GetName(), err)
+			v.ResponseChannel <- "\nThe server is shutting down, and your character could not be saved.\n"
+		} else {
+			v.ResponseChannel <- shutdownMsg
+		}
+		// the handler closes the connection once it sees the channel is closed
+		close(v.ResponseChannel)
+	}
+
+	saveWorldSnapshot()
+
+	done := make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		fmt.Printf("LOG %v Gave up waiting for connections to close.\n", time.Now())
+	}
+}
@@ -0,0 +1,165 @@
+package skills
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lpbeast/ecbmud/combat"
+	"github.com/lpbeast/ecbmud/items"
+)
+
+// Who a skill can be used on
+const (
+	// a mob, which starts a fight with it if there isn't one already
+	TARGET_OFFENSIVE = "offensive"
+	// the user, or another player in the room
+	TARGET_DEFENSIVE = "defensive"
+	// only the user
+	TARGET_SELF = "self"
+)
+
+// What a skill does to its target
+const (
+	EFFECT_DAMAGE = "damage"
+	EFFECT_HEAL   = "heal"
+	// puts Affect on the target
+	EFFECT_AFFECT = "affect"
+)
+
+// A Skill is anything characters can learn from their race or class. Spells are
+// used with CAST, and every other skill is a command of its own.
+type Skill struct {
+	Name  string
+	Spell bool
+	// mana it costs to use
+	MP int
+	// ticks the user has to wait afterwards before they can do anything else
+	Cooldown int
+	Target   string
+	Effect   string
+	// damage done or HP healed, before the user's bonuses
+	Dice items.Dice
+	// only for starting a fight, not for using once it's going
+	Opener bool
+	// what an EFFECT_AFFECT skill puts on its target
+	Affect *combat.Affect
+}
+
+// Registry is every skill in the game, by name. Races and classes refer to these
+// names, and LoadClasses checks that they exist.
+var Registry = map[string]*Skill{
+	"bash": {
+		Name:     "bash",
+		Cooldown: 20,
+		Target:   TARGET_OFFENSIVE,
+		Effect:   EFFECT_DAMAGE,
+		Dice:     items.Dice{Num: 1, Sides: 6},
+	},
+	"kick": {
+		Name:     "kick",
+		Cooldown: 15,
+		Target:   TARGET_OFFENSIVE,
+		Effect:   EFFECT_DAMAGE,
+		Dice:     items.Dice{Num: 1, Sides: 8},
+	},
+	"backstab": {
+		Name:     "backstab",
+		Cooldown: 20,
+		Target:   TARGET_OFFENSIVE,
+		Effect:   EFFECT_DAMAGE,
+		Dice:     items.Dice{Num: 3, Sides: 6},
+		Opener:   true,
+	},
+	"magic missile": {
+		Name:     "magic missile",
+		Spell:    true,
+		MP:       10,
+		Cooldown: 10,
+		Target:   TARGET_OFFENSIVE,
+		Effect:   EFFECT_DAMAGE,
+		Dice:     items.Dice{Num: 2, Sides: 6},
+	},
+	"heal": {
+		Name:     "heal",
+		Spell:    true,
+		MP:       15,
+		Cooldown: 10,
+		Target:   TARGET_DEFENSIVE,
+		Effect:   EFFECT_HEAL,
+		Dice:     items.Dice{Num: 2, Sides: 8, Bonus: 4},
+	},
+	"poison": {
+		Name:     "poison",
+		Cooldown: 20,
+		Target:   TARGET_OFFENSIVE,
+		Effect:   EFFECT_AFFECT,
+		Affect: &combat.Affect{
+			Name:       "poison",
+			Desc:       "poisoned",
+			Duration:   300,
+			HitMod:     -1,
+			TickDamage: 3,
+			WearOff:    "The poison wears off.",
+		},
+	},
+	"bless": {
+		Name:     "bless",
+		Spell:    true,
+		MP:       10,
+		Cooldown: 10,
+		Target:   TARGET_DEFENSIVE,
+		Effect:   EFFECT_AFFECT,
+		Affect: &combat.Affect{
+			Name:     "bless",
+			Desc:     "blessed",
+			Duration: 600,
+			HitMod:   2,
+			WearOff:  "You feel less righteous.",
+		},
+	},
+	"armor": {
+		Name:     "armor",
+		Spell:    true,
+		MP:       10,
+		Cooldown: 10,
+		Target:   TARGET_SELF,
+		Effect:   EFFECT_AFFECT,
+		Affect: &combat.Affect{
+			Name:     "armor",
+			Desc:     "armored",
+			Duration: 600,
+			DefMod:   5,
+			WearOff:  "Your magical armor fades away.",
+		},
+	},
+}
+
+// Find looks up a spell, or a skill that isn't a spell, by the start of its name.
+func Find(stub string, spell bool) (*Skill, bool) {
+	names := []string{}
+	for k := range Registry {
+		names = append(names, k)
+	}
+	// so "ba" is always the same skill, if there were ever two it could be
+	sort.Strings(names)
+	for _, v := range names {
+		s := Registry[v]
+		if s.Spell == spell && strings.HasPrefix(v, stub) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Commands lists the skills that are commands of their own, which is all of them
+// but the spells.
+func Commands() []string {
+	names := []string{}
+	for k, v := range Registry {
+		if !v.Spell {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lpbeast/ecbmud/rooms"
+	"github.com/lpbeast/ecbmud/store"
+)
+
+// saveWorldSnapshot writes out the state of the world so it can be put back after
+// a reboot, if there's a -world-snapshot file to write it to.
+func saveWorldSnapshot() {
+	if *worldSnapshot == "" {
+		return
+	}
+	data, err := json.Marshal(rooms.Snapshot())
+	if err == nil {
+		err = store.WriteFileAtomic(*worldSnapshot, data)
+	}
+	if err != nil {
+		log.Printf("Unable to save world snapshot: %s\n", err)
+	}
+}
+
+// loadWorldSnapshot puts back the world from the last snapshot, if there is one,
+// or from a backup of it if the last one didn't get saved properly.
+func loadWorldSnapshot() error {
+	if *worldSnapshot == "" {
+		return nil
+	}
+	var ws rooms.WorldSnapshot
+	err := store.ReadFileWithBackups(*worldSnapshot, func(data []byte) error {
+		// start afresh for each file tried, so nothing from a corrupt one is kept
+		ws = rooms.WorldSnapshot{}
+		return json.Unmarshal(data, &ws)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("Restoring world from snapshot taken %v.\n", ws.Saved.Format(time.DateTime))
+	rooms.RestoreSnapshot(ws)
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backups is how many previous saves of each file the file store keeps, as
+// <file>.1 (the newest) to <file>.N.
+var Backups = 3
+
+// WriteFileAtomic saves data to fname so that a crash part way through can never
+// leave it half written: the data goes to a temp file that's synced to disk and
+// then renamed over the original, after the original has been moved into the
+// backups.
+func WriteFileAtomic(fname string, data []byte) error {
+	tempName := fname + ".tmp"
+	f, err := os.OpenFile(tempName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	// the temp file has to be closed before it's renamed, or Windows says it's in
+	// use by another process
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	if err := rotateBackups(fname); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	if err := os.Rename(tempName, fname); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(fname))
+	return nil
+}
+
+// rotateBackups moves fname to fname.1, fname.1 to fname.2 and so on, dropping the
+// oldest. If the server dies before the new save is renamed into place, the load
+// finds fname missing and uses fname.1, which is the last good save.
+func rotateBackups(fname string) error {
+	if Backups < 1 {
+		return nil
+	}
+	for i := Backups - 1; i >= 1; i-- {
+		err := os.Rename(backupName(fname, i), backupName(fname, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	err := os.Rename(fname, backupName(fname, 1))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func backupName(fname string, n int) string {
+	return fmt.Sprintf("%s.%d", fname, n)
+}
+
+// syncDir makes the renames in a directory stick if the machine goes down. Not
+// every OS can sync a directory (Windows can't), and the files themselves are
+// already safe by then, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// ReadFileWithBackups loads fname with decode, falling back to the newest backup that
+// decodes properly if fname is missing or corrupt. It returns os.ErrNotExist if
+// there was never anything saved.
+func ReadFileWithBackups(fname string, decode func(data []byte) error) error {
+	var firstErr error
+	for i := 0; i <= Backups; i++ {
+		name := fname
+		if i > 0 {
+			name = backupName(fname, i)
+		}
+		data, err := os.ReadFile(name)
+		if err == nil {
+			err = decode(data)
+			if err == nil {
+				if i > 0 {
+					fmt.Printf("LOG %v Could not load %s (%s), loaded backup %s instead.\n", time.Now(), fname, firstErr, name)
+				}
+				return nil
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
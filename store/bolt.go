@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lpbeast/ecbmud/chara"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	charBucket    = []byte("characters")
+	accountBucket = []byte("accounts")
+)
+
+// BoltStore keeps everything in a single bbolt database file, as JSON, keyed by
+// name. Every save is its own transaction, so a crash can't leave one half written.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	// the timeout stops a second copy of the server hanging forever waiting for
+	// the lock on the file
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{charBucket, accountBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) load(bucket []byte, key string, decode func(data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("%s %q: %w", bucket, key, chara.ErrNotFound)
+		}
+		return decode(data)
+	})
+}
+
+func (s *BoltStore) save(bucket []byte, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+func (s *BoltStore) list(bucket []byte) ([]string, error) {
+	names := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	return names, err
+}
+
+func (s *BoltStore) LoadCharacter(name string) (chara.CharSheet, error) {
+	cs := chara.CharSheet{}
+	err := s.load(charBucket, name, func(data []byte) error {
+		var err error
+		cs, err = chara.DecodeCharacter(data)
+		return err
+	})
+	return cs, err
+}
+
+func (s *BoltStore) SaveCharacter(cs *chara.CharSheet) error {
+	return s.save(charBucket, cs.Name, cs)
+}
+
+func (s *BoltStore) ListCharacters() ([]string, error) {
+	return s.list(charBucket)
+}
+
+func (s *BoltStore) DeleteCharacter(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(charBucket)
+		if b.Get([]byte(name)) == nil {
+			return fmt.Errorf("%s %q: %w", charBucket, name, chara.ErrNotFound)
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+func (s *BoltStore) LoadAccount(name string) (chara.Account, error) {
+	acct := chara.Account{}
+	err := s.load(accountBucket, name, func(data []byte) error {
+		return json.Unmarshal(data, &acct)
+	})
+	return acct, err
+}
+
+func (s *BoltStore) SaveAccount(acct chara.Account) error {
+	return s.save(accountBucket, acct.Name, acct)
+}
+
+func (s *BoltStore) ListAccounts() ([]string, error) {
+	return s.list(accountBucket)
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
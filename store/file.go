@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lpbeast/ecbmud/chara"
+)
+
+const accountsFileName = "accounts.json"
+
+// FileStore keeps each character in its own JSON file, and all the accounts
+// together in one more, all in the same directory. Every save keeps the last
+// few versions of the file as backups.
+type FileStore struct {
+	dir string
+	// the accounts file gets read, changed and written back whole
+	mu sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) charFile(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *FileStore) LoadCharacter(name string) (chara.CharSheet, error) {
+	cs := chara.CharSheet{}
+	err := ReadFileWithBackups(s.charFile(name), func(data []byte) error {
+		var err error
+		cs, err = chara.DecodeCharacter(data)
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return cs, fmt.Errorf("character %q: %w", name, chara.ErrNotFound)
+	}
+	return cs, err
+}
+
+func (s *FileStore) SaveCharacter(cs *chara.CharSheet) error {
+	jChar, err := json.MarshalIndent(cs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.charFile(cs.Name), jChar)
+}
+
+func (s *FileStore) ListCharacters() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, v := range files {
+		base := filepath.Base(v)
+		if base == accountsFileName {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(base, ".json"))
+	}
+	return names, nil
+}
+
+func (s *FileStore) DeleteCharacter(name string) error {
+	fname := s.charFile(name)
+	err := os.Remove(fname)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("character %q: %w", name, chara.ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	// the backups have to go too, or loading would find them and bring it back
+	for i := 1; i <= Backups; i++ {
+		os.Remove(backupName(fname, i))
+	}
+	return nil
+}
+
+func (s *FileStore) loadAccounts() (map[string]chara.Account, error) {
+	var al map[string]chara.Account
+	err := ReadFileWithBackups(filepath.Join(s.dir, accountsFileName), func(data []byte) error {
+		al = map[string]chara.Account{}
+		return json.Unmarshal(data, &al)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]chara.Account{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return al, nil
+}
+
+func (s *FileStore) LoadAccount(name string) (chara.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	al, err := s.loadAccounts()
+	if err != nil {
+		return chara.Account{}, err
+	}
+	acct, ok := al[name]
+	if !ok {
+		return chara.Account{}, fmt.Errorf("account %q: %w", name, chara.ErrNotFound)
+	}
+	return acct, nil
+}
+
+func (s *FileStore) SaveAccount(acct chara.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	al, err := s.loadAccounts()
+	if err != nil {
+		return err
+	}
+	al[acct.Name] = acct
+	jAccts, err := json.MarshalIndent(al, "", "\t")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(s.dir, accountsFileName), jAccts)
+}
+
+func (s *FileStore) ListAccounts() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	al, err := s.loadAccounts()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for k := range al {
+		names = append(names, k)
+	}
+	return names, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/lpbeast/ecbmud/chara"
+)
+
+// Open returns a store of the named kind. "file" keeps JSON files in dir, and
+// "bolt" keeps everything in the database file at dbPath.
+func Open(kind string, dir string, dbPath string) (chara.Store, error) {
+	switch kind {
+	case "file":
+		return NewFileStore(dir)
+	case "bolt":
+		return NewBoltStore(dbPath)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", kind)
+	}
+}
+
+// Copy copies every account and character from one store to another, for
+// switching a server over from one kind of store to another.
+func Copy(dst chara.Store, src chara.Store) error {
+	accts, err := src.ListAccounts()
+	if err != nil {
+		return err
+	}
+	for _, v := range accts {
+		acct, err := src.LoadAccount(v)
+		if err != nil {
+			return err
+		}
+		if err := dst.SaveAccount(acct); err != nil {
+			return err
+		}
+	}
+	chars, err := src.ListCharacters()
+	if err != nil {
+		return err
+	}
+	for _, v := range chars {
+		cs, err := src.LoadCharacter(v)
+		if err != nil {
+			return err
+		}
+		if err := dst.SaveCharacter(&cs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
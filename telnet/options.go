@@ -0,0 +1,155 @@
+package telnet
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lpbeast/ecbmud/ansi"
+)
+
+// Each option has two sides: whether the server is doing it ("local") and whether
+// the client is doing it ("remote"). pending is set when we have asked for a change
+// and are waiting for the other end to agree or refuse, so that their answer is not
+// mistaken for a fresh request and answered again, which is how negotiation loops
+// happen.
+type optState struct {
+	enabled bool
+	pending bool
+}
+
+// Options is the per-connection table of negotiated telnet options. It is written
+// by the goroutine reading from the connection and read by anything that wants to
+// know what the client can do, so everything goes through the mutex.
+type Options struct {
+	mu            sync.Mutex
+	local         map[byte]*optState
+	remote        map[byte]*optState
+	supportLocal  map[byte]bool
+	supportRemote map[byte]bool
+	width         int
+	height        int
+	termTypes     []string
+	colorMode     ansi.Mode
+}
+
+func newOptions() *Options {
+	return &Options{
+		local:  map[byte]*optState{},
+		remote: map[byte]*optState{},
+		// options we will agree to do if the client asks
+		supportLocal: map[byte]bool{
+			SGA:   true,
+			GMCP:  true,
+			MCCP2: true,
+		},
+		// options we will let the client do if it offers
+		supportRemote: map[byte]bool{
+			NAWS:  true,
+			TTYPE: true,
+		},
+		width:  80,
+		height: 24,
+		// pretty much every MUD client and terminal can do the basic 16 colors,
+		// so assume that much until TTYPE says otherwise
+		colorMode: ansi.ANSI16,
+	}
+}
+
+func (o *Options) localState(opt byte) *optState {
+	if o.local[opt] == nil {
+		o.local[opt] = &optState{}
+	}
+	return o.local[opt]
+}
+
+func (o *Options) remoteState(opt byte) *optState {
+	if o.remote[opt] == nil {
+		o.remote[opt] = &optState{}
+	}
+	return o.remote[opt]
+}
+
+// Local reports whether the server has agreed to perform an option.
+func (o *Options) Local(opt byte) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.localState(opt).enabled
+}
+
+// Remote reports whether the client has agreed to perform an option.
+func (o *Options) Remote(opt byte) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.remoteState(opt).enabled
+}
+
+// WindowSize returns the client's terminal size as reported by NAWS, or 80x24 if
+// the client hasn't told us.
+func (o *Options) WindowSize() (int, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.width, o.height
+}
+
+func (o *Options) setWindowSize(w, h int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if w > 0 {
+		o.width = w
+	}
+	if h > 0 {
+		o.height = h
+	}
+}
+
+// TermTypes returns the terminal types the client reported, in the order it
+// reported them.
+func (o *Options) TermTypes() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string{}, o.termTypes...)
+}
+
+// ColorMode is the best color the client has told us it can display.
+func (o *Options) ColorMode() ansi.Mode {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.colorMode
+}
+
+// addTermType records a TTYPE answer and works out what it says about color
+// support. It returns false once the client starts repeating itself, or has been
+// asked enough times, so we know to stop asking.
+func (o *Options) addTermType(tt string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tt = strings.ToUpper(tt)
+	for _, v := range o.termTypes {
+		if v == tt {
+			return false
+		}
+	}
+	o.termTypes = append(o.termTypes, tt)
+
+	mode := ansi.ANSI16
+	switch {
+	case strings.HasPrefix(tt, "MTTS "):
+		bits, err := strconv.Atoi(tt[5:])
+		if err == nil {
+			if bits&256 != 0 {
+				mode = ansi.TrueColor
+			} else if bits&8 != 0 {
+				mode = ansi.ANSI256
+			}
+		}
+	case strings.Contains(tt, "TRUECOLOR"), strings.HasPrefix(tt, "MUDLET"):
+		mode = ansi.TrueColor
+	case strings.Contains(tt, "256COLOR"):
+		mode = ansi.ANSI256
+	}
+	if mode > o.colorMode {
+		o.colorMode = mode
+	}
+	return len(o.termTypes) < 3
+}
@@ -0,0 +1,530 @@
+package telnet
+
+import (
+	"bufio"
+	"compress/zlib"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/lpbeast/ecbmud/ansi"
+)
+
+// Telnet commands, from RFC 854
+const (
+	SE   byte = 240
+	NOP  byte = 241
+	GA   byte = 249
+	SB   byte = 250
+	WILL byte = 251
+	WONT byte = 252
+	DO   byte = 253
+	DONT byte = 254
+	IAC  byte = 255
+)
+
+// Telnet options
+const (
+	ECHO  byte = 1
+	SGA   byte = 3
+	TTYPE byte = 24
+	NAWS  byte = 31
+	MCCP2 byte = 86
+	GMCP  byte = 201
+)
+
+// Control messages go down the same string channels as ordinary game output, so
+// they're marked with a leading NUL, which never shows up in text meant for players.
+// The connection picks them out in WriteString and acts on them instead of sending them.
+const ctrlPrefix = "\x00"
+
+const (
+	// EchoOff asks the client to stop echoing what the player types, for passwords.
+	EchoOff = ctrlPrefix + "echo:off"
+	// EchoOn turns client echo back on after EchoOff.
+	EchoOn = ctrlPrefix + "echo:on"
+	// ColorOn and ColorOff set the player's color preference. With color on, the
+	// connection uses as much color as the client says it can show.
+	ColorOn  = ctrlPrefix + "color:on"
+	ColorOff = ctrlPrefix + "color:off"
+)
+
+// Limits on input, so a client can't use up memory by never ending a line or a
+// subnegotiation. Anything past them is thrown away.
+const (
+	maxLineLength   = 4096
+	maxSubnegLength = 512
+)
+
+// TTYPE subnegotiation commands
+const (
+	ttypeIS   byte = 0
+	ttypeSEND byte = 1
+)
+
+// IsControl reports whether s is a control message rather than text, for other
+// kinds of connection that have to pick them out for themselves.
+func IsControl(s string) bool {
+	return strings.HasPrefix(s, ctrlPrefix)
+}
+
+// GMCPMessage builds a control message carrying a GMCP package name and its JSON
+// payload. It's dropped if the client didn't agree to GMCP.
+func GMCPMessage(pkg string, data []byte) string {
+	return ctrlPrefix + "gmcp:" + pkg + " " + string(data)
+}
+
+// Conn wraps a network connection, stripping telnet commands out of the input,
+// answering option negotiation, and escaping output.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// the reader goroutine answers negotiation while the handler is writing output,
+	// so writes to the socket have to take turns
+	wmu    sync.Mutex
+	opts   *Options
+	lastCR bool
+	// set by ColorOff, to strip color whatever the client supports
+	noColor bool
+	// zw is non-nil while MCCP2 compression is running
+	zw    *zlib.Writer
+	stats Stats
+}
+
+// Stats counts output bytes for MCCP2, before and after compression. Only output
+// sent while compression is on is counted.
+type Stats struct {
+	Raw        int64
+	Compressed int64
+}
+
+// Saved is how many bytes compression kept off the wire.
+func (s Stats) Saved() int64 {
+	return s.Raw - s.Compressed
+}
+
+// countingWriter sits between the zlib writer and the socket to see how much
+// actually gets sent.
+type countingWriter struct {
+	c *Conn
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.c.conn.Write(p)
+	w.c.stats.Compressed += int64(n)
+	return n, err
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		conn: c,
+		r:    bufio.NewReader(c),
+		opts: newOptions(),
+	}
+}
+
+// Negotiate offers the options the server wants from the start of the connection.
+// Clients that don't speak telnet just ignore the bytes.
+func (c *Conn) Negotiate() error {
+	if err := c.requestLocal(SGA); err != nil {
+		return err
+	}
+	if err := c.requestLocal(GMCP); err != nil {
+		return err
+	}
+	if err := c.requestLocal(MCCP2); err != nil {
+		return err
+	}
+	if err := c.requestRemote(NAWS); err != nil {
+		return err
+	}
+	return c.requestRemote(TTYPE)
+}
+
+func (c *Conn) Options() *Options {
+	return c.opts
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// CompressionStats reports how much output MCCP2 has compressed so far.
+func (c *Conn) CompressionStats() Stats {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.stats
+}
+
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	if c.zw != nil {
+		c.zw.Close()
+		c.zw = nil
+	}
+	c.wmu.Unlock()
+	return c.conn.Close()
+}
+
+// ReadLine returns the next line of player input with any telnet commands removed,
+// handling whichever of CR LF, CR NUL, or bare LF the client uses to end lines.
+func (c *Conn) ReadLine() (string, error) {
+	line := []byte{}
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c.lastCR {
+			c.lastCR = false
+			if b == '\n' || b == 0 {
+				continue
+			}
+		}
+		switch {
+		case b == IAC:
+			if err := c.readCommand(); err != nil {
+				return "", err
+			}
+		case b == '\r':
+			c.lastCR = true
+			return string(line), nil
+		case b == '\n':
+			return string(line), nil
+		case b == 8 || b == 127:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case (b >= 32 || b == '\t') && len(line) < maxLineLength:
+			line = append(line, b)
+		}
+	}
+}
+
+func (c *Conn) readCommand() error {
+	cmd, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch cmd {
+	case WILL, WONT, DO, DONT:
+		opt, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		return c.handleNegotiation(cmd, opt)
+	case SB:
+		data, err := c.readSubneg()
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			return c.handleSubneg(data[0], data[1:])
+		}
+	}
+	// IAC IAC is an escaped 255, which can't be part of valid text anyway, and
+	// NOP, GA and the rest don't need anything done about them
+	return nil
+}
+
+// readSubneg collects everything between IAC SB and IAC SE, unescaping doubled IACs.
+func (c *Conn) readSubneg() ([]byte, error) {
+	data := []byte{}
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != IAC {
+			if len(data) < maxSubnegLength {
+				data = append(data, b)
+			}
+			continue
+		}
+		b, err = c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case SE:
+			return data, nil
+		case IAC:
+			if len(data) < maxSubnegLength {
+				data = append(data, IAC)
+			}
+		}
+	}
+}
+
+func (c *Conn) handleSubneg(opt byte, data []byte) error {
+	switch opt {
+	case NAWS:
+		if len(data) >= 4 {
+			w := int(data[0])<<8 | int(data[1])
+			h := int(data[2])<<8 | int(data[3])
+			c.opts.setWindowSize(w, h)
+		}
+	case TTYPE:
+		// clients following MTTS give a different answer each time they're asked:
+		// client name, terminal type, then a bit field of what they support. Keep
+		// asking until they repeat themselves.
+		if len(data) > 0 && data[0] == ttypeIS {
+			if c.opts.addTermType(string(data[1:])) {
+				return c.sendSubneg(TTYPE, []byte{ttypeSEND})
+			}
+		}
+	}
+	return nil
+}
+
+// handleNegotiation follows the gist of RFC 1143: only answer a request if it
+// changes the state of the option, and treat an answer to our own request as an
+// answer rather than a new request.
+func (c *Conn) handleNegotiation(cmd, opt byte) error {
+	var reply byte
+	wasLocal, wasRemote := c.opts.Local(opt), c.opts.Remote(opt)
+	c.opts.mu.Lock()
+	switch cmd {
+	case DO:
+		st := c.opts.localState(opt)
+		switch {
+		case st.pending:
+			st.pending = false
+			st.enabled = true
+		case st.enabled:
+		case c.opts.supportLocal[opt]:
+			st.enabled = true
+			reply = WILL
+		default:
+			reply = WONT
+		}
+	case DONT:
+		st := c.opts.localState(opt)
+		switch {
+		case st.pending:
+			st.pending = false
+			st.enabled = false
+		case st.enabled:
+			st.enabled = false
+			reply = WONT
+		}
+	case WILL:
+		st := c.opts.remoteState(opt)
+		switch {
+		case st.pending:
+			st.pending = false
+			st.enabled = true
+		case st.enabled:
+		case c.opts.supportRemote[opt]:
+			st.enabled = true
+			reply = DO
+		default:
+			reply = DONT
+		}
+	case WONT:
+		st := c.opts.remoteState(opt)
+		switch {
+		case st.pending:
+			st.pending = false
+			st.enabled = false
+		case st.enabled:
+			st.enabled = false
+			reply = DONT
+		}
+	}
+	c.opts.mu.Unlock()
+	if reply != 0 {
+		if err := c.sendCommand(reply, opt); err != nil {
+			return err
+		}
+	}
+	return c.optionChanged(opt, wasLocal, wasRemote)
+}
+
+// optionChanged starts or stops anything that depends on an option being turned
+// on or off.
+func (c *Conn) optionChanged(opt byte, wasLocal bool, wasRemote bool) error {
+	switch opt {
+	case MCCP2:
+		if wasLocal == c.opts.Local(opt) {
+			return nil
+		}
+		if wasLocal {
+			return c.stopCompression()
+		}
+		return c.startCompression()
+	case TTYPE:
+		if !wasRemote && c.opts.Remote(opt) {
+			return c.sendSubneg(TTYPE, []byte{ttypeSEND})
+		}
+	}
+	return nil
+}
+
+// startCompression begins an MCCP2 stream. The IAC SB MCCP2 IAC SE that announces
+// it is the last thing sent uncompressed.
+func (c *Conn) startCompression() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.zw != nil {
+		return nil
+	}
+	if _, err := c.conn.Write([]byte{IAC, SB, MCCP2, IAC, SE}); err != nil {
+		return err
+	}
+	c.zw = zlib.NewWriter(countingWriter{c})
+	return nil
+}
+
+// stopCompression ends the stream cleanly if the client changes its mind.
+func (c *Conn) stopCompression() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.zw == nil {
+		return nil
+	}
+	err := c.zw.Close()
+	c.zw = nil
+	return err
+}
+
+// requestLocal offers to perform an option (IAC WILL).
+func (c *Conn) requestLocal(opt byte) error {
+	c.opts.mu.Lock()
+	st := c.opts.localState(opt)
+	if st.enabled || st.pending {
+		c.opts.mu.Unlock()
+		return nil
+	}
+	st.pending = true
+	c.opts.mu.Unlock()
+	return c.sendCommand(WILL, opt)
+}
+
+// disableLocal stops performing an option (IAC WONT). The other end isn't allowed
+// to refuse, so there's no need to wait for an answer.
+func (c *Conn) disableLocal(opt byte) error {
+	c.opts.mu.Lock()
+	st := c.opts.localState(opt)
+	if !st.enabled && !st.pending {
+		c.opts.mu.Unlock()
+		return nil
+	}
+	st.enabled = false
+	st.pending = false
+	c.opts.mu.Unlock()
+	return c.sendCommand(WONT, opt)
+}
+
+// requestRemote asks the client to perform an option (IAC DO).
+func (c *Conn) requestRemote(opt byte) error {
+	c.opts.mu.Lock()
+	st := c.opts.remoteState(opt)
+	if st.enabled || st.pending {
+		c.opts.mu.Unlock()
+		return nil
+	}
+	st.pending = true
+	c.opts.mu.Unlock()
+	return c.sendCommand(DO, opt)
+}
+
+func (c *Conn) sendCommand(cmd, opt byte) error {
+	return c.write([]byte{IAC, cmd, opt})
+}
+
+func (c *Conn) write(b []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.zw != nil {
+		c.stats.Raw += int64(len(b))
+		if _, err := c.zw.Write(b); err != nil {
+			return err
+		}
+		// flush every write, or the client sits waiting for text that's stuck
+		// in the compressor
+		return c.zw.Flush()
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// WriteString sends game output to the client, turning newlines into the CR LF
+// telnet expects and doubling any IAC bytes so they aren't taken as commands.
+// Control messages are acted on instead of being sent.
+func (c *Conn) WriteString(s string) (int, error) {
+	if strings.HasPrefix(s, ctrlPrefix) {
+		return 0, c.control(s[len(ctrlPrefix):])
+	}
+	n := len(s)
+	mode := c.opts.ColorMode()
+	if c.noColor {
+		mode = ansi.None
+	}
+	s = ansi.Render(s, mode)
+	out := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case IAC:
+			out = append(out, IAC, IAC)
+		case '\n':
+			if i == 0 || s[i-1] != '\r' {
+				out = append(out, '\r')
+			}
+			out = append(out, '\n')
+		default:
+			out = append(out, s[i])
+		}
+	}
+	if err := c.write(out); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.WriteString(string(p))
+}
+
+// sendSubneg wraps data in IAC SB opt ... IAC SE, escaping any IACs inside.
+func (c *Conn) sendSubneg(opt byte, data []byte) error {
+	out := make([]byte, 0, len(data)+5)
+	out = append(out, IAC, SB, opt)
+	for _, b := range data {
+		if b == IAC {
+			out = append(out, IAC)
+		}
+		out = append(out, b)
+	}
+	out = append(out, IAC, SE)
+	return c.write(out)
+}
+
+func (c *Conn) control(msg string) error {
+	if gmcp, ok := strings.CutPrefix(msg, "gmcp:"); ok {
+		if !c.opts.Local(GMCP) {
+			return nil
+		}
+		return c.sendSubneg(GMCP, []byte(gmcp))
+	}
+	switch msg {
+	case "echo:off":
+		// if the server says it will echo, the client stops echoing, and then
+		// the server doesn't actually echo anything
+		return c.requestLocal(ECHO)
+	case "echo:on":
+		wasOff := c.opts.Local(ECHO)
+		if err := c.disableLocal(ECHO); err != nil {
+			return err
+		}
+		// the newline at the end of the password wasn't echoed either
+		if wasOff {
+			return c.write([]byte("\r\n"))
+		}
+	case "color:on":
+		c.noColor = false
+	case "color:off":
+		c.noColor = true
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// pipeConn gives a Conn with a client on the other end that sends input and
+// ignores whatever comes back.
+func pipeConn(t *testing.T, input []byte) *Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	go io.Copy(io.Discard, client)
+	go client.Write(input)
+	return NewConn(server)
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	input := append(bytes.Repeat([]byte("a"), 1<<20), "\r\nlook\r\n"...)
+	c := pipeConn(t, input)
+
+	line, err := c.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != strings.Repeat("a", maxLineLength) {
+		t.Errorf("got a line of %d bytes, want it cut to %d", len(line), maxLineLength)
+	}
+	line, err = c.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "look" {
+		t.Errorf("next line is %q, want \"look\"", line)
+	}
+}
+
+func TestSubnegTooLong(t *testing.T) {
+	input := []byte{IAC, SB, TTYPE, ttypeIS}
+	input = append(input, bytes.Repeat([]byte("x"), 1<<20)...)
+	input = append(input, IAC, SE)
+	input = append(input, "look\r\n"...)
+	c := pipeConn(t, input)
+
+	line, err := c.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "look" {
+		t.Errorf("line after the subnegotiation is %q, want \"look\"", line)
+	}
+	tt := c.Options().TermTypes()
+	// the limit counts the option and the IS byte as well
+	if len(tt) != 1 {
+		t.Fatalf("got %d terminal types, want 1", len(tt))
+	}
+	if len(tt[0]) != maxSubnegLength-2 {
+		t.Errorf("terminal type is %d bytes, want it cut to %d", len(tt[0]), maxSubnegLength-2)
+	}
+}
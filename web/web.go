@@ -0,0 +1,95 @@
+package web
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lpbeast/ecbmud/ansi"
+	"github.com/lpbeast/ecbmud/telnet"
+	"golang.org/x/net/websocket"
+)
+
+// The browser client is a single page with no external dependencies, built into
+// the binary so there's nothing else to deploy.
+//
+//go:embed client.html
+var clientPage []byte
+
+// Conn is a player connected through the browser client. Each WebSocket text
+// message from the browser is one line of input, and each message to the browser
+// is a chunk of output with color already turned into ANSI codes, which the page
+// knows how to display.
+type Conn struct {
+	ws        *websocket.Conn
+	noColor   bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(ws *websocket.Conn) *Conn {
+	return &Conn{ws: ws, done: make(chan struct{})}
+}
+
+func (c *Conn) ReadLine() (string, error) {
+	var line string
+	if err := websocket.Message.Receive(c.ws, &line); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *Conn) WriteString(s string) (int, error) {
+	if telnet.IsControl(s) {
+		switch s {
+		case telnet.ColorOn:
+			c.noColor = false
+		case telnet.ColorOff:
+			c.noColor = true
+		case telnet.EchoOff, telnet.EchoOn:
+			// the page switches its input box to and from a password field
+			if err := websocket.Message.Send(c.ws, s); err != nil {
+				return 0, err
+			}
+		}
+		// GMCP isn't available to the browser client
+		return 0, nil
+	}
+	mode := ansi.TrueColor
+	if c.noColor {
+		mode = ansi.None
+	}
+	if err := websocket.Message.Send(c.ws, ansi.Render(s, mode)); err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+func (c *Conn) Close() error {
+	err := c.ws.Close()
+	c.closeOnce.Do(func() { close(c.done) })
+	return err
+}
+
+// Handler serves the browser client at / and the WebSocket endpoint at /ws.
+// connect is called with each new connection, and has to hand it off to be
+// handled elsewhere, since the WebSocket is closed when the handler returns.
+// The handler waits until the connection has been closed.
+func Handler(connect func(*Conn)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(clientPage)
+	})
+	mux.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
+		c := newConn(ws)
+		connect(c)
+		<-c.done
+	}))
+	return mux
+}
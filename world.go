@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"slices"
 	"time"
 
 	"github.com/lpbeast/ecbmud/chara"
@@ -13,6 +14,8 @@ import (
 	"github.com/lpbeast/ecbmud/rooms"
 )
 
+const maxAutosavesPerTick = 2
+
 func doServerTick() {
 	start := time.Now()
 	healTick := tickCounter%200 == 0
@@ -37,6 +40,9 @@ func doServerTick() {
 					}
 				}
 			}
+			if !tickMobAffects(v) {
+				continue
+			}
 
 			mLoc := z.Rooms[v.Loc]
 			if len(v.TempInfo.Targets) > 0 {
@@ -73,18 +79,17 @@ func doServerTick() {
 		}
 	}
 
-	// heal player characters on a 20 second tick
-	// TODO: base this on vitality once stats are in
+	// heal player characters on a 20 second tick, depending on their vitality and wisdom
 	if healTick {
 		for _, v := range chara.GlobalUserList {
 			if v.CharData.HPCurrent < v.CharData.HPMax {
-				v.CharData.HPCurrent += 5
+				v.CharData.HPCurrent += v.CharData.HPRegen()
 				if v.CharData.HPCurrent > v.CharData.HPMax {
 					v.CharData.HPCurrent = v.CharData.HPMax
 				}
 			}
 			if v.CharData.MPCurrent < v.CharData.MPMax {
-				v.CharData.MPCurrent += 5
+				v.CharData.MPCurrent += v.CharData.MPRegen()
 				if v.CharData.MPCurrent > v.CharData.MPMax {
 					v.CharData.MPCurrent = v.CharData.MPMax
 				}
@@ -92,6 +97,41 @@ func doServerTick() {
 		}
 	}
 
+	for _, v := range chara.GlobalUserList {
+		tickPCAffects(v)
+	}
+
+	// save and remove characters whose players haven't come back in time
+	for _, v := range chara.GlobalUserList {
+		if v.TempInfo.LinkDead {
+			v.TempInfo.LinkDeadTicks++
+			if v.TempInfo.LinkDeadTicks >= int(*linkDeadGrace/(100*time.Millisecond)) {
+				fmt.Printf("LOG %v Removing link-dead character %q\n", time.Now(), v.GetName())
+				logOut(v)
+			}
+		}
+	}
+
+	// autosave anyone who hasn't been saved for a while. Only a couple get saved on
+	// any one tick, so that when everyone logs in at once after a restart they
+	// don't all come due together and make one tick take ages.
+	if *autosave > 0 {
+		autosaveTicks := max(int(*autosave/(100*time.Millisecond)), 1)
+		saved := 0
+		for _, v := range chara.GlobalUserList {
+			v.TempInfo.AutosaveTicks++
+			if saved < maxAutosavesPerTick && v.TempInfo.AutosaveTicks >= autosaveTicks {
+				if err := v.Save(); err != nil {
+					log.Printf("Unable to autosave %q: %s\n", v.GetName(), err)
+				}
+				saved++
+			}
+		}
+		if tickCounter%autosaveTicks == 0 {
+			saveWorldSnapshot()
+		}
+	}
+
 	// move on to player commands
 	// go through each connected PC one at a time, if they have any commands waiting
 	// in the queue, process the first one.
@@ -99,8 +139,12 @@ func doServerTick() {
 	// item or mob on the same tick
 	// that is, it'll still be random which player gets to eg take an item, if they try
 	// on the same tick, but the code will not end up in a confused or incomplete state
+	// anyone who's just used a skill has to wait out its cooldown first, and their
+	// commands stay queued until then
 	for _, v := range chara.GlobalUserList {
-		if len(v.IncomingCmds) > 0 {
+		if v.Cooldown > 0 {
+			v.Cooldown--
+		} else if len(v.IncomingCmds) > 0 {
 			// response := fmt.Sprintf("DEBUG Server: Received %q from %q\n", v.IncomingCmds[0], v.CharData.Name)
 			// fmt.Print(response)
 			// v.ResponseChannel <- response
@@ -121,26 +165,33 @@ func doServerTick() {
 		if len(v.TempInfo.Targets) > 0 {
 			if v.TempInfo.AutoAtkCD <= 0 {
 				DoCombat(v, v.TempInfo.Targets[0], true)
-				if v.TempInfo.Targets[0].GetHP() <= 0 {
-					m, ok := v.TempInfo.Targets[0].(*mobs.Mob)
-					if ok {
-						chLoc := rooms.GlobalZoneList[v.CharData.Zone].Rooms[v.CharData.Location]
-						chMsg := fmt.Sprintf("\nYou strike %s down!\n", m.GetName())
-						otherMsg := fmt.Sprintf("\n%s strikes %s down!\n", v.GetName(), m.GetName())
-						chLoc.LocalAnnouncePCMsg(v, chMsg, otherMsg)
-						MakeMobDead(m)
-						if len(v.TempInfo.Targets) == 0 {
-							v.ExitCombat()
-						}
-					}
-				}
 			} else {
 				v.TempInfo.AutoAtkCD -= 1
 			}
 		}
+		// then deal with anything they've killed, by autoattack or with a skill,
+		// which might not have been their first target
+		for _, t := range slices.Clone(v.TempInfo.Targets) {
+			m, ok := t.(*mobs.Mob)
+			if ok && m.GetHP() <= 0 {
+				chLoc := rooms.GlobalZoneList[v.CharData.Zone].Rooms[v.CharData.Location]
+				chMsg := fmt.Sprintf("\nYou strike %s down!\n", m.GetName())
+				otherMsg := fmt.Sprintf("\n%s strikes %s down!\n", v.GetName(), m.GetName())
+				chLoc.LocalAnnouncePCMsg(v, chMsg, otherMsg)
+				MakeMobDead(m, v)
+				if len(v.TempInfo.Targets) == 0 {
+					v.ExitCombat()
+				}
+			}
+		}
 
 	}
 
+	// let GMCP clients know about any HP/MP changes from this tick
+	for _, v := range chara.GlobalUserList {
+		v.UpdateVitals()
+	}
+
 	processingTime := time.Since(start)
 	sleepTime := (100 * time.Millisecond) - processingTime
 	if sleepTime < 0 {
@@ -173,6 +224,49 @@ func mobWanderDecision(m *mobs.Mob, exits map[string]rooms.TransDest) (string, b
 	return "", false
 }
 
+// tickMobAffects counts down a mob's affects and does any damage they do. It
+// returns false if they killed the mob.
+func tickMobAffects(m *mobs.Mob) bool {
+	hurt, worn := m.Affects.Tick()
+	mLoc := rooms.GlobalZoneList[m.Zone].Rooms[m.Loc]
+	for _, a := range hurt {
+		m.ReceiveDamage(a.TickDamage)
+		mLoc.LocalAnnounce(fmt.Sprintf("\n%s suffers %d damage from %s.\n", m.GetName(), a.TickDamage, a.Name))
+	}
+	for _, a := range worn {
+		mLoc.LocalAnnounce(fmt.Sprintf("\n%s is no longer %s.\n", m.GetName(), a.Desc))
+	}
+	if m.HPCurrent <= 0 {
+		// nobody gets the credit, apart from everyone fighting it
+		MakeMobDead(m, nil)
+		return false
+	}
+	return true
+}
+
+// tickPCAffects counts down a player's affects, does any damage they do, and tells
+// them about any that wear off.
+func tickPCAffects(c *chara.ActiveCharacter) {
+	hurt, worn := c.CharData.Affects.Tick()
+	if len(hurt) == 0 && len(worn) == 0 {
+		return
+	}
+	chLoc := rooms.GlobalZoneList[c.CharData.Zone].Rooms[c.CharData.Location]
+	for _, a := range hurt {
+		c.ReceiveDamage(a.TickDamage)
+		chMsg := fmt.Sprintf("\nYou suffer {RED}%d{x} damage from %s.\n", a.TickDamage, a.Name)
+		otherMsg := fmt.Sprintf("\n%s suffers %d damage from %s.\n", c.GetName(), a.TickDamage, a.Name)
+		chLoc.LocalAnnouncePCMsg(c, chMsg, otherMsg)
+	}
+	for _, a := range worn {
+		c.ResponseChannel <- "\n" + a.WearOff + "\n"
+		c.SendPrompt()
+	}
+	if c.CharData.HPCurrent <= 0 {
+		MakePCDead(c)
+	}
+}
+
 func DoCombat(attacker, defender combat.Combatant, attackerIsPlayer bool) {
 	var p *chara.ActiveCharacter
 	var ok bool
@@ -193,11 +287,22 @@ func DoCombat(attacker, defender combat.Combatant, attackerIsPlayer bool) {
 }
 
 // These functions have to go here to avoid import loops
-func MakeMobDead(m *mobs.Mob) {
+
+// MakeMobDead takes a mob out of the world until the next repop, and shares out
+// its experience between everyone who was fighting it. killer can be nil if it
+// wasn't a player that killed it.
+func MakeMobDead(m *mobs.Mob, killer *chara.ActiveCharacter) {
 	mLoc := rooms.GlobalZoneList[m.Zone].Rooms[m.Loc]
+	attackers := []*chara.ActiveCharacter{}
+	if killer != nil {
+		attackers = append(attackers, killer)
+	}
 	for _, p := range mLoc.PCs {
 		for i, t := range p.TempInfo.Targets {
 			if t == m {
+				if p != killer {
+					attackers = append(attackers, p)
+				}
 				if i == len(p.TempInfo.Targets)-1 {
 					p.TempInfo.Targets = p.TempInfo.Targets[:i]
 				} else {
@@ -210,6 +315,7 @@ func MakeMobDead(m *mobs.Mob) {
 		}
 	}
 	m.ExitCombat()
+	m.Affects = combat.Affects{}
 	mZone := rooms.GlobalZoneList[m.Zone]
 	for k, v := range mLoc.Mobs {
 		if v == m {
@@ -223,6 +329,18 @@ func MakeMobDead(m *mobs.Mob) {
 	mLoc.LocalAnnounce(fmt.Sprintf("\n%s falls over dead!\n", m.GetName()))
 	delete(mZone.ActiveMobs, m.ID)
 	mZone.DeadMobs[m.ID] = m
+
+	if m.XP > 0 && len(attackers) > 0 {
+		share := max(m.XP/len(attackers), 1)
+		for _, p := range attackers {
+			if p.GainXP(share) > 0 {
+				pLoc := rooms.GlobalZoneList[p.CharData.Zone].Rooms[p.CharData.Location]
+				pLoc.LocalAnnouncePCMsg(p, "", fmt.Sprintf("\n%s looks more experienced.\n", p.GetName()))
+			} else {
+				p.SendPrompt()
+			}
+		}
+	}
 }
 
 func MakePCDead(c *chara.ActiveCharacter) {
@@ -242,6 +360,7 @@ func MakePCDead(c *chara.ActiveCharacter) {
 		}
 	}
 	c.ExitCombat()
+	c.CharData.Affects = combat.Affects{}
 	chMsg := "\nYou were slain!\nYour consciousness fades, but you wake in a new place...\n"
 	otherMsg := fmt.Sprintf("\n%s was slain! They fall to the ground and disappear.\n", c.GetName())
 	chLoc.LocalAnnouncePCMsg(c, chMsg, otherMsg)